@@ -3,15 +3,19 @@ module github.com/c-fandango/rocketchat-term
 go 1.20
 
 require (
+	github.com/alecthomas/chroma/v2 v2.14.0
 	github.com/gorilla/websocket v1.5.0
 	github.com/knadh/koanf/parsers/yaml v0.1.0
 	github.com/knadh/koanf/providers/confmap v0.1.0
 	github.com/knadh/koanf/providers/file v0.1.0
 	github.com/knadh/koanf/v2 v2.0.1
+	github.com/rivo/uniseg v0.4.7
+	go.etcd.io/bbolt v1.3.9
 	golang.org/x/term v0.8.0
 )
 
 require (
+	github.com/dlclark/regexp2 v1.11.0 // indirect
 	github.com/fsnotify/fsnotify v1.6.0 // indirect
 	github.com/knadh/koanf/maps v0.1.1 // indirect
 	github.com/mitchellh/copystructure v1.2.0 // indirect
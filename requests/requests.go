@@ -1,7 +1,9 @@
 package requests
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -60,3 +62,44 @@ func GetRequest(endpoint string, params []map[string]string) ([]byte, error) {
 
 	return body, nil
 }
+
+func PostRequest(endpoint string, payload interface{}) ([]byte, error) {
+
+	u := url.URL{Scheme: "https", Host: Host, Path: endpoint}
+
+	data, err := json.Marshal(payload)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request body")
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, u.String(), bytes.NewReader(data))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct request")
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("X-Auth-Token", Token)
+	req.Header.Add("X-User-Id", User)
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request returned an error code %v", resp.Status)
+	}
+
+	return body, nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var messagesBucket = []byte("messages")
+var roomsBucket = []byte("rooms")
+var usersBucket = []byte("users")
+
+// messageArchive stores every message received in a local bolt database, the database is
+// only opened while in use so that searches can run alongside the feed
+type messageArchive struct {
+	path    string
+	start   sync.Once
+	pending chan roomMessage
+}
+
+type archiveQuery struct {
+	text  string
+	room  string
+	user  string
+	since time.Time
+	until time.Time
+}
+
+// messageKey orders messages by the time they were sent
+func messageKey(message messageSchema) []byte {
+	return []byte(fmt.Sprintf("%016d/%s", message.SentTS.TS, message.ID))
+}
+
+func (a *messageArchive) open(readOnly bool) (*bolt.DB, error) {
+	return bolt.Open(a.path, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: readOnly})
+}
+
+// add queues a message to be archived, messages are written in the background so that
+// the feed doesn't wait on the database while a search has it open
+func (a *messageArchive) add(room roomSchema, message messageSchema) {
+	a.start.Do(func() {
+		a.pending = make(chan roomMessage, 1000)
+		go a.write()
+	})
+
+	select {
+	case a.pending <- roomMessage{room, message}:
+	default:
+		log.Println("archive queue full, dropping message ", message.ID)
+	}
+}
+
+// write saves queued messages, anything queued while the database was busy is saved
+// together
+func (a *messageArchive) write() {
+	for first := range a.pending {
+		batch := []roomMessage{first}
+
+	collect:
+		for {
+			select {
+			case next := <-a.pending:
+				batch = append(batch, next)
+			default:
+				break collect
+			}
+		}
+
+		var err error
+		for attempt := 0; attempt < 5; attempt++ {
+			if err = a.save(batch); err == nil {
+				break
+			}
+			time.Sleep(time.Second)
+		}
+
+		if err != nil {
+			log.Println("failed to archive messages ", err)
+		}
+	}
+}
+
+func (a *messageArchive) save(batch []roomMessage) error {
+	db, err := a.open(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		for _, entry := range batch {
+			room, message := entry.room, entry.message
+
+			// messages are stored on their own, rooms are kept in their own bucket
+			room.Messages = nil
+
+			items := []struct {
+				bucket []byte
+				key    []byte
+				value  interface{}
+			}{
+				{messagesBucket, messageKey(message), message},
+				{roomsBucket, []byte(room.ID), room},
+				{usersBucket, []byte(message.Sender.ID), message.Sender},
+			}
+
+			for _, item := range items {
+				if len(item.key) == 0 {
+					continue
+				}
+
+				bucket, err := tx.CreateBucketIfNotExists(item.bucket)
+				if err != nil {
+					return err
+				}
+
+				value, err := json.Marshal(item.value)
+				if err != nil {
+					return err
+				}
+
+				err = bucket.Put(item.key, value)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (q archiveQuery) matches(room roomSchema, message messageSchema) bool {
+	if !q.since.IsZero() && message.SentTS.TS < int(q.since.UnixMilli()) {
+		return false
+	}
+	if !q.until.IsZero() && message.SentTS.TS > int(q.until.UnixMilli()) {
+		return false
+	}
+
+	if q.room != "" && !strings.EqualFold(q.room, room.Name) && !strings.EqualFold(q.room, room.DisplayName) && q.room != room.ID {
+		return false
+	}
+
+	if q.user != "" && !strings.EqualFold(q.user, message.Sender.Username) && !strings.EqualFold(q.user, message.Sender.Name) {
+		return false
+	}
+
+	content := strings.ToLower(message.Content)
+	for _, word := range strings.Fields(strings.ToLower(q.text)) {
+		if !strings.Contains(content, word) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// search returns the archived messages matching the query in the order they were sent
+func (a *messageArchive) search(q archiveQuery) ([]roomMessage, error) {
+	db, err := a.open(true)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	matched := make([]roomMessage, 0)
+
+	err = db.View(func(tx *bolt.Tx) error {
+		messages := tx.Bucket(messagesBucket)
+		rooms := tx.Bucket(roomsBucket)
+
+		if messages == nil || rooms == nil {
+			return nil
+		}
+
+		c := messages.Cursor()
+
+		k, v := c.First()
+		if !q.since.IsZero() {
+			k, v = c.Seek([]byte(fmt.Sprintf("%016d", q.since.UnixMilli())))
+		}
+
+		for ; k != nil; k, v = c.Next() {
+			var message messageSchema
+			if err := json.Unmarshal(v, &message); err != nil {
+				return err
+			}
+
+			var room roomSchema
+			if value := rooms.Get([]byte(message.RoomID)); value != nil {
+				if err := json.Unmarshal(value, &room); err != nil {
+					return err
+				}
+			}
+			room.ID = message.RoomID
+			room.makeName()
+
+			if q.matches(room, message) {
+				matched = append(matched, roomMessage{room, message})
+			}
+		}
+		return nil
+	})
+
+	return matched, err
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/c-fandango/rocketchat-term/utils"
+)
+
+// highlightCode syntax highlights code in the given language, returning false if the
+// language isn't known
+func highlightCode(language string, code string) (string, bool) {
+	if language == "" || config.colourMode == "none" {
+		return "", false
+	}
+
+	lexer := lexers.Get(language)
+	if lexer == nil {
+		return "", false
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	formatter := formatters.Get("terminal256")
+	switch config.colourMode {
+	case "truecolour":
+		formatter = formatters.Get("terminal16m")
+	case "16":
+		formatter = formatters.Get("terminal16")
+	}
+
+	style := styles.Get(config.codeTheme)
+
+	iterator, err := lexer.Tokenise(nil, code)
+	if err != nil {
+		return "", false
+	}
+
+	var b strings.Builder
+
+	err = formatter.Format(&b, style, iterator)
+	if err != nil {
+		return "", false
+	}
+
+	return strings.TrimRight(b.String(), "\n"), true
+}
+
+// codeBorder starts each line of a boxed code block
+var codeBorder = "\033[0m" + dimOn + "│" + dimOff + " "
+
+// renderCodeBlock draws a fenced code block in a box, syntax highlighted when the
+// language is known and in the plain code colour otherwise
+func renderCodeBlock(language string, code string) string {
+	resetColour := "\033[0m"
+	border := codeBorder
+
+	code = expandTabs(strings.TrimRight(code, "\n"), 4)
+
+	highlighted, ok := highlightCode(language, code)
+	if !ok {
+		highlighted = config.codeColour + strings.ReplaceAll(code, "\n", resetColour+"\n"+config.codeColour) + resetColour
+	}
+
+	lines := strings.Split(highlighted, "\n")
+	for i, line := range lines {
+		lines[i] = border + line
+	}
+
+	header := dimOn + strings.TrimSpace("┌─ "+language) + dimOff
+	footer := dimOn + "└─" + dimOff
+
+	return protectCode(header + "\n" + strings.Join(lines, "\n") + resetColour + "\n" + footer)
+}
+
+// expandTabs replaces tabs with spaces up to the next tab stop, tabs have no width
+// when wrapping so they would break the box
+func expandTabs(code string, width int) string {
+	if !strings.Contains(code, "\t") {
+		return code
+	}
+
+	lines := strings.Split(code, "\n")
+	for i, line := range lines {
+		var b strings.Builder
+		column := 0
+		for _, char := range line {
+			if char == '\t' {
+				spaces := width - column%width
+				b.WriteString(strings.Repeat(" ", spaces))
+				column += spaces
+				continue
+			}
+			b.WriteRune(char)
+			column += utils.StringWidth(string(char))
+		}
+		lines[i] = b.String()
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// rendered code is wrapped in these private use characters so that the emoji, mention
+// and ticket passes leave it alone, they are removed before printing
+const codeStart = "\uE000"
+const codeEnd = "\uE001"
+
+func protectCode(code string) string {
+	return codeStart + code + codeEnd
+}
+
+func unprotectCode(content string) string {
+	return strings.NewReplacer(codeStart, "", codeEnd, "").Replace(content)
+}
+
+// replaceOutsideCode applies replace to the text outside of rendered code
+func replaceOutsideCode(input string, replace func(string) string) string {
+	var b strings.Builder
+
+	for {
+		start := strings.Index(input, codeStart)
+		if start < 0 {
+			break
+		}
+		end := strings.Index(input[start:], codeEnd)
+		if end < 0 {
+			break
+		}
+		end += start + len(codeEnd)
+
+		b.WriteString(replace(input[:start]))
+		b.WriteString(input[start:end])
+		input = input[end:]
+	}
+	b.WriteString(replace(input))
+
+	return b.String()
+}
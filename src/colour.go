@@ -0,0 +1,70 @@
+package main
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// colourIndex picks a colour for an id, ids are hashed so that similar names don't share colours
+func colourIndex(id string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32() % uint32(n))
+}
+
+type colourPicker struct {
+	mu         sync.Mutex
+	lastSender string
+	lastIndex  int
+}
+
+// userColour returns the highlight and text colour of a user, if distinct adjacent colours
+// are configured then a sender never shares a colour with the message above it
+func (p *colourPicker) userColour(user userSchema) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id := user.ID
+	if id == "" {
+		id = user.Username
+	}
+
+	n := len(config.userTextColours)
+	i := colourIndex(id, n)
+
+	// a run of messages from one sender keeps the colour it started with, even if that
+	// was bumped off the colour of the sender before
+	if config.distinctAdjacent && n > 1 && user.Username == p.lastSender {
+		i = p.lastIndex
+	} else if config.distinctAdjacent && n > 1 && p.lastSender != "" && i == p.lastIndex {
+		i = (i + 1) % n
+	}
+
+	p.lastSender = user.Username
+	p.lastIndex = i
+
+	if override, ok := config.userColourOverrides[user.Username]; ok {
+		return config.userBgColours[colourIndex(id, len(config.userBgColours))] + override
+	}
+
+	return config.userBgColours[colourIndex(id, len(config.userBgColours))] + config.userTextColours[i]
+}
+
+func (p *colourPicker) roomColour(room roomSchema) string {
+	id := room.ID
+	if id == "" {
+		id = room.DisplayName
+	}
+
+	textColour := config.roomTextColours[colourIndex(id, len(config.roomTextColours))]
+
+	if override, ok := config.roomColourOverrides[room.Name]; ok {
+		return override + textColour
+	}
+
+	if typeColour, ok := config.roomTypeColours[room.kind()]; ok {
+		return typeColour + textColour
+	}
+
+	return config.roomBgColours[colourIndex(id, len(config.roomBgColours))] + textColour
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// watchInput reads commands typed into the terminal while the feed is running
+func watchInput(allRooms *rooms) {
+	scanner := bufio.NewScanner(os.Stdin)
+
+	for scanner.Scan() {
+		runCommand(scanner.Text(), allRooms)
+	}
+}
+
+func runCommand(line string, allRooms *rooms) {
+	fields := strings.Fields(line)
+
+	// a bare enter acknowledges the feed
+	if len(fields) == 0 {
+		notifier.clear()
+		allRooms.printStatusLine()
+		return
+	}
+
+	args := strings.Join(fields[1:], " ")
+
+	switch fields[0] {
+	case "/unread":
+		allRooms.printUnread()
+	case "/read":
+		err := allRooms.markRead(args)
+		if err != nil {
+			fmt.Println(err)
+		}
+	case "/search":
+		// a leading #room limits the search to that room
+		room := ""
+		if len(fields) > 1 && strings.HasPrefix(fields[1], "#") {
+			room = fields[1]
+			args = strings.Join(fields[2:], " ")
+		}
+		err := serverSearch(allRooms, room, args, 100, archiveQuery{})
+		if err != nil {
+			fmt.Println(err)
+		}
+	case "/history":
+		if len(fields) < 2 {
+			fmt.Println("usage: /history <room> [count|since]")
+			return
+		}
+		// the optional argument is either a message count or a time like 2h
+		limit := 50
+		var since time.Time
+		if len(fields) > 2 {
+			if n, err := strconv.Atoi(fields[2]); err == nil {
+				limit = n
+			} else if ts, err := parseTimeArg(fields[2]); err == nil {
+				since = ts
+				limit = 200
+			} else {
+				fmt.Println(err)
+				return
+			}
+		}
+		err := printHistory(allRooms, fields[1], since, limit)
+		if err != nil {
+			fmt.Println(err)
+		}
+	default:
+		fmt.Printf("unknown command %s\n", fields[0])
+	}
+}
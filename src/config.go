@@ -3,12 +3,18 @@ package main
 import (
 	"fmt"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/knadh/koanf/parsers/yaml"
 	"github.com/knadh/koanf/providers/file"
 	"github.com/knadh/koanf/v2"
 
 	"github.com/c-fandango/rocketchat-term/utils"
+	"golang.org/x/term"
 )
 
 var defaultCols = []string{
@@ -26,12 +32,19 @@ var defaultCols = []string{
 	"220", // gold1
 }
 
+// defaultCols16 are the basic and bright colours of 16 colour terminals, without black and white
+var defaultCols16 = []string{"1", "2", "3", "4", "5", "6", "9", "10", "11", "12", "13", "14"}
+
 var black = []string{"\033[38;5;0m"}
 var nothing = []string{"\033[0m"}
 
 const defaultCode = "\033[38;5;186m"
 const defaultNotify = "\033[48;5;160m"
 const defaultTicket = "\033[38;5;39m"
+const defaultMention = "\033[48;5;196m"
+const defaultGroupMention = "\033[48;5;166m"
+const defaultKeyword = "\033[38;5;226m"
+const defaultEmoji = "\033[38;5;215m"
 
 type configSchema struct {
 	host  string
@@ -41,9 +54,35 @@ type configSchema struct {
 	userBgColours   []string
 	roomTextColours []string
 	roomBgColours   []string
-	codeColour      string
-	notifyColour    string
-	ticketColour    string
+
+	userColourOverrides map[string]string
+	roomColourOverrides map[string]string
+	roomTypeColours     map[string]string
+	distinctAdjacent    bool
+	codeColour          string
+	notifyColour        string
+	ticketColour        string
+
+	colourMode string
+	codeTheme  string
+	hyperlinks bool
+	permalinks bool
+
+	roomPrefixes bool
+
+	keepShortcodes bool
+
+	timeFormat string
+	location   *time.Location
+
+	groupWindow int
+	template    *template.Template
+
+	mentionColour      string
+	groupMentionColour string
+	keywordColour      string
+	emojiColour        string
+	keywords           *regexp.Regexp
 
 	timeWidth          int
 	roomWidth          int
@@ -52,9 +91,59 @@ type configSchema struct {
 	newLineMarkerWidth int
 	roomNameMaxWidth   int
 
+	ignoreUsers          []*regexp.Regexp
+	ignoreBots           bool
+	onlyRoomTypes        map[string]bool
+	ignoreRoomTypes      map[string]bool
+	ignoreSystemTypes    map[string]bool
+	hiddenReportInterval int
+
+	notifyDirect    bool
+	notifyMentions  bool
+	notifyKeywords  bool
+	notifyRooms     []string
+	notifyBell      bool
+	notifyTitle     bool
+	notifyCommand   string
+	notifyRateLimit int
+
+	archiveEnabled bool
+
+	syncRead      bool
+	markDisplayed bool
+	markReadDelay int
+
 	debug bool
 }
 
+// colourCodes converts the hex colours and 256 colour palette numbers set for a colour to
+// escape codes for the colour mode, layer is 38 for text and 48 for highlights, in 256
+// colour mode hex colours are matched to the palette and 16 colour mode only uses its
+// own palette, nil is returned if nothing applies
+func colourCodes(mode string, hex []string, codes []string, layer string) []string {
+	switch {
+	case mode == "16" || mode == "none":
+		return nil
+	case mode == "256" && len(codes) != 0:
+		return utils.MapperStr(codes, numToAnsi("\033["+layer+";5"))
+	case mode == "256" && len(hex) != 0:
+		return utils.MapperStr(utils.MapperStr(hex, hexTo256), numToAnsi("\033["+layer+";5"))
+	case len(hex) != 0:
+		return utils.MapperStr(hex, hexToAnsi("\033["+layer+";2"))
+	case len(codes) != 0:
+		return utils.MapperStr(codes, numToAnsi("\033["+layer+";5"))
+	}
+	return nil
+}
+
+// optional makes a list of a single setting, empty if it isn't set
+func optional(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
+
 func hexToAnsi(prefix string) func(string) string {
 	return func(code string) string {
 		r, g, b, err := utils.HexToRGB(code)
@@ -71,7 +160,8 @@ func numToAnsi(prefix string) func(string) string {
 	}
 }
 
-func (c *configSchema) loadConf(path string) {
+// loadConf reads the config file at path, theme overrides the theme set in the config if given
+func (c *configSchema) loadConf(path string, theme string) {
 	var k = koanf.New(".")
 
 	if _, err := os.Stat(path); err == nil {
@@ -81,6 +171,15 @@ func (c *configSchema) loadConf(path string) {
                 }
 	}
 
+	// themes are loaded underneath the config file so any colours set there, under either
+	// colours or colours256, still apply
+	if theme == "" {
+		theme = k.String("display.theme")
+	}
+	if theme != "" {
+		k = loadTheme(theme, path)
+	}
+
 	// read logging opts
 	c.debug = k.Bool("logging.debug")
 
@@ -88,6 +187,52 @@ func (c *configSchema) loadConf(path string) {
 	c.host = k.String("connection.host")
 	c.token = k.String("connection.token")
 
+	// read filter opts
+	c.ignoreUsers = compileUserPatterns(k.Strings("filters.ignore_users"))
+	c.ignoreBots = k.Bool("filters.ignore_bots")
+	c.onlyRoomTypes = compileRoomTypes(k.Strings("filters.room_types"), "room_types")
+	c.ignoreRoomTypes = compileRoomTypes(k.Strings("filters.ignore_room_types"), "ignore_room_types")
+	c.ignoreSystemTypes = make(map[string]bool)
+	for _, kind := range k.Strings("filters.ignore_system") {
+		c.ignoreSystemTypes[kind] = true
+	}
+	c.hiddenReportInterval = 300
+	if n := k.Int("filters.report_interval"); n > 0 {
+		c.hiddenReportInterval = n
+	}
+
+	// read highlight opts
+	if keywords := k.Strings("highlight.keywords"); len(keywords) != 0 {
+		c.keywords = regexp.MustCompile(`\b(?:` + strings.Join(utils.MapperStr(keywords, regexp.QuoteMeta), "|") + `)\b`)
+	}
+
+	// read notification opts
+	c.notifyDirect = k.Bool("notifications.direct_messages")
+	c.notifyMentions = k.Bool("notifications.mentions")
+	c.notifyKeywords = k.Bool("notifications.keywords")
+	c.notifyRooms = k.Strings("notifications.rooms")
+	c.notifyBell = k.Bool("notifications.bell")
+	c.notifyTitle = k.Bool("notifications.title")
+	c.notifyCommand = k.String("notifications.command")
+	c.notifyRateLimit = 10
+	if k.Exists("notifications.rate_limit") {
+		c.notifyRateLimit = k.Int("notifications.rate_limit")
+	}
+
+	// read archive opts
+	c.archiveEnabled = true
+	if k.Exists("archive.enabled") {
+		c.archiveEnabled = k.Bool("archive.enabled")
+	}
+
+	// read unread opts
+	c.syncRead = k.Bool("unread.sync_read")
+	c.markDisplayed = k.Bool("unread.mark_displayed")
+	c.markReadDelay = 5
+	if n := k.Int("unread.mark_read_delay"); n > 0 {
+		c.markReadDelay = n
+	}
+
 	// set indent defaults
 	c.timeWidth = 15
 	c.roomWidth = 24
@@ -116,6 +261,57 @@ func (c *configSchema) loadConf(path string) {
 		c.roomNameMaxWidth = n
 	}
 
+	// read colour mode, full rgb colours are assumed if any hex colours are given
+	// colour mode is one of truecolour, 256, 16 or none
+	c.colourMode = "256"
+	if k.Exists("colours") {
+		c.colourMode = "truecolour"
+	}
+	if mode := k.String("display.colour_mode"); mode != "" {
+		c.colourMode = mode
+	}
+
+	c.codeTheme = "monokai"
+	if theme := k.String("display.code_theme"); theme != "" {
+		c.codeTheme = theme
+	}
+
+	switch k.String("display.hyperlinks") {
+	case "true", "on":
+		c.hyperlinks = true
+	case "false", "off":
+		c.hyperlinks = false
+	default:
+		c.hyperlinks = hyperlinksSupported()
+	}
+	c.permalinks = k.Bool("display.permalinks")
+	c.roomPrefixes = true
+	if k.Exists("display.room_prefixes") {
+		c.roomPrefixes = k.Bool("display.room_prefixes")
+	}
+	c.keepShortcodes = k.Bool("display.emoji_shortcodes")
+
+	c.groupWindow = k.Int("display.group_window")
+
+	if layout := k.String("display.template"); layout != "" {
+		c.template = parseTemplate(layout)
+	}
+
+	// read time opts
+	c.timeFormat = "12h"
+	if layout := k.String("display.time_format"); layout != "" {
+		c.timeFormat = layout
+	}
+
+	c.location = time.Local
+	if zone := k.String("display.timezone"); zone != "" {
+		location, err := time.LoadLocation(zone)
+		if err != nil {
+			panic("invalid timezone")
+		}
+		c.location = location
+	}
+
 	// set colour defaults
 	c.userTextColours = utils.MapperStr(defaultCols, numToAnsi("\033[38;5"))
 	c.userBgColours = nothing
@@ -124,47 +320,121 @@ func (c *configSchema) loadConf(path string) {
 	c.codeColour = defaultCode
 	c.notifyColour = defaultNotify
 	c.ticketColour = defaultTicket
+	c.mentionColour = defaultMention
+	c.groupMentionColour = defaultGroupMention
+	c.keywordColour = defaultKeyword
+	c.emojiColour = defaultEmoji
 
-	// read colour opts
-	if len(k.Strings("colours.user_text")) != 0 {
-		c.userTextColours = utils.MapperStr(k.Strings("colours.user_text"), hexToAnsi("\033[38;2"))
-	} else if len(k.Strings("colours256.user_text")) != 0 {
-		c.userTextColours = utils.MapperStr(k.Strings("colours256.user_text"), numToAnsi("\033[38;5"))
+	if c.colourMode == "16" {
+		c.setColours16()
 	}
 
-	if len(k.Strings("colours.user_highlight")) != 0 {
-		c.userBgColours = utils.MapperStr(k.Strings("colours.user_highlight"), hexToAnsi("\033[48;2"))
-	} else if len(k.Strings("colours256.user_highlight")) != 0 {
-		c.userBgColours = utils.MapperStr(k.Strings("colours256.user_highlight"), numToAnsi("\033[48;5"))
+	// read colour opts, the colour mode decides which of colours and colours256 are used
+	readColours := func(name string, layer string, current []string) []string {
+		if codes := colourCodes(c.colourMode, k.Strings("colours."+name), k.Strings("colours256."+name), layer); codes != nil {
+			return codes
+		}
+		return current
 	}
-
-	if len(k.Strings("colours.room_text")) != 0 {
-		c.roomTextColours = utils.MapperStr(k.Strings("colours.room_text"), hexToAnsi("\033[38;2"))
-	} else if len(k.Strings("colours256.room_text")) != 0 {
-		c.roomTextColours = utils.MapperStr(k.Strings("colours256.room_text"), numToAnsi("\033[38;5"))
+	readColour := func(name string, layer string, current string) string {
+		if codes := colourCodes(c.colourMode, optional(k.String("colours."+name)), optional(k.String("colours256."+name)), layer); codes != nil {
+			return codes[0]
+		}
+		return current
+	}
+	readColourMap := func(name string, layer string) map[string]string {
+		output := make(map[string]string)
+		keys := append(k.MapKeys("colours."+name), k.MapKeys("colours256."+name)...)
+		for _, key := range keys {
+			// palette numbers are read with String as StringMap skips values that aren't strings
+			hex := optional(k.String("colours." + name + "." + key))
+			codes := optional(k.String("colours256." + name + "." + key))
+			if colour := colourCodes(c.colourMode, hex, codes, layer); colour != nil {
+				output[key] = colour[0]
+			}
+		}
+		return output
 	}
 
-	if len(k.Strings("colours.room_highlight")) != 0 {
-		c.roomBgColours = utils.MapperStr(k.Strings("colours.room_highlight"), hexToAnsi("\033[48;2"))
-	} else if len(k.Strings("colours256.room_highlight")) != 0 {
-		c.roomBgColours = utils.MapperStr(k.Strings("colours256.room_highlight"), numToAnsi("\033[48;5"))
+	c.userTextColours = readColours("user_text", "38", c.userTextColours)
+	c.userBgColours = readColours("user_highlight", "48", c.userBgColours)
+	c.roomTextColours = readColours("room_text", "38", c.roomTextColours)
+	c.roomBgColours = readColours("room_highlight", "48", c.roomBgColours)
+
+	c.codeColour = readColour("code", "38", c.codeColour)
+	c.notifyColour = readColour("notify", "48", c.notifyColour)
+	c.ticketColour = readColour("ticket", "38", c.ticketColour)
+	c.mentionColour = readColour("mention", "48", c.mentionColour)
+	c.groupMentionColour = readColour("group_mention", "48", c.groupMentionColour)
+	c.keywordColour = readColour("keyword", "38", c.keywordColour)
+	c.emojiColour = readColour("emoji", "38", c.emojiColour)
+
+	// read per user, per room and per room type colour overrides, users get a text colour
+	// and rooms a highlight, rooms with their own colour keep it over their type's
+	c.userColourOverrides = readColourMap("users", "38")
+	c.roomColourOverrides = readColourMap("rooms", "48")
+	c.roomTypeColours = readColourMap("room_types", "48")
+
+	c.distinctAdjacent = k.Bool("display.distinct_adjacent")
+
+	if noColour || os.Getenv("NO_COLOR") != "" || !term.IsTerminal(int(os.Stdout.Fd())) {
+		c.colourMode = "none"
 	}
 
-	if len(k.String("colours.code")) != 0 {
-		c.codeColour = hexToAnsi("\033[38;2")(k.String("colours.code"))
-	} else if len(k.String("colours256.code")) != 0 {
-		c.codeColour = numToAnsi("\033[38;5")(k.String("colours256.code"))
+	if c.colourMode == "none" {
+		c.setMonochrome()
 	}
+}
 
-	if len(k.String("colours.notify")) != 0 {
-		c.notifyColour = hexToAnsi("\033[48;2")(k.String("colours.notify"))
-	} else if len(k.String("colours256.notify")) != 0 {
-		c.notifyColour = numToAnsi("\033[48;5")(k.String("colours256.notify"))
+// setColours16 sets the default colours to the 16 colour palette for old terminals,
+// these use the sgr 30-37 and 90-97 colour codes rather than 256 colour indexes
+func (c *configSchema) setColours16() {
+	code := func(base int) func(string) string {
+		return func(n string) string {
+			i, _ := strconv.Atoi(n)
+			if i >= 8 {
+				return fmt.Sprintf("\033[%dm", base+60+i-8)
+			}
+			return fmt.Sprintf("\033[%dm", base+i)
+		}
 	}
 
-	if len(k.String("colours.ticket")) != 0 {
-		c.ticketColour = hexToAnsi("\033[38;2")(k.String("colours.ticket"))
-	} else if len(k.String("colours256.ticket")) != 0 {
-		c.ticketColour = numToAnsi("\033[38;5")(k.String("colours256.ticket"))
+	c.userTextColours = utils.MapperStr(defaultCols16, code(30))
+	c.roomTextColours = []string{"\033[30m"}
+	c.roomBgColours = utils.MapperStr(defaultCols16, code(40))
+	c.codeColour = "\033[33m"
+	c.notifyColour = "\033[41m"
+	c.ticketColour = "\033[94m"
+	c.mentionColour = "\033[101m"
+	c.groupMentionColour = "\033[43m"
+	c.keywordColour = "\033[93m"
+	c.emojiColour = "\033[33m"
+}
+
+// setMonochrome turns off colours, styles and hyperlinks for plain text output
+func (c *configSchema) setMonochrome() {
+	c.colourMode = "none"
+	c.hyperlinks = false
+
+	c.userTextColours = []string{""}
+	c.userBgColours = []string{""}
+	c.roomTextColours = []string{""}
+	c.roomBgColours = []string{""}
+	c.codeColour = ""
+	c.notifyColour = ""
+	c.ticketColour = ""
+	c.mentionColour = ""
+	c.groupMentionColour = ""
+	c.keywordColour = ""
+	c.emojiColour = ""
+
+	for user := range c.userColourOverrides {
+		c.userColourOverrides[user] = ""
+	}
+	for room := range c.roomColourOverrides {
+		c.roomColourOverrides[room] = ""
+	}
+	for kind := range c.roomTypeColours {
+		c.roomTypeColours[kind] = ""
 	}
 }
@@ -2,8 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
+	"log"
 
 	"github.com/c-fandango/rocketchat-term/creds"
+	"github.com/c-fandango/rocketchat-term/requests"
 )
 
 func getCredentials(cachePath string) (map[string]string, error) {
@@ -34,3 +37,66 @@ func getCredentials(cachePath string) (map[string]string, error) {
 
 	return outputCreds, err
 }
+
+// restLogin authenticates the requests package for commands that only use the rest api,
+// cached credentials are used as is, otherwise the user is logged in over rest
+func restLogin(cachePath string) error {
+	credentials, err := getCredentials(cachePath)
+	if err != nil {
+		log.Println(err)
+	}
+
+	requests.Host = credentials["host"]
+
+	if credentials["user"] != "" && credentials["token"] != "" {
+		requests.User = credentials["user"]
+		requests.Token = credentials["token"]
+		return me.fetchMe()
+	}
+
+	var payload interface{} = map[string]string{"resume": credentials["token"]}
+
+	if credentials["token"] == "" {
+		payload = map[string]interface{}{
+			"ldap":        true,
+			"username":    credentials["username"],
+			"ldapPass":    credentials["password"],
+			"ldapOptions": map[string]string{},
+		}
+	}
+
+	response, err := requests.PostRequest(`/api/v1/login`, payload)
+
+	if err != nil {
+		creds.ClearCache(cachePath)
+		return fmt.Errorf("authorisation failed")
+	}
+
+	loginResult := struct {
+		Data struct {
+			User  string     `json:"userId"`
+			Token string     `json:"authToken"`
+			Me    userSchema `json:"me"`
+		} `json:"data"`
+	}{}
+
+	err = json.Unmarshal(response, &loginResult)
+
+	if err != nil {
+		return err
+	}
+
+	requests.User = loginResult.Data.User
+	requests.Token = loginResult.Data.Token
+	me = loginResult.Data.Me
+
+	tokenCache := map[string]string{
+		"host":  requests.Host,
+		"user":  requests.User,
+		"token": requests.Token,
+	}
+
+	cache, _ := json.Marshal(tokenCache)
+
+	return creds.WriteCache(cachePath, cache)
+}
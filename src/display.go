@@ -5,8 +5,11 @@ import (
 	"regexp"
 	"strings"
 	"time"
+	"unicode"
 
+	"github.com/c-fandango/rocketchat-term/requests"
 	"github.com/c-fandango/rocketchat-term/utils"
+	"github.com/rivo/uniseg"
 )
 
 func makeInitials(name string, delimiter string) string {
@@ -15,7 +18,11 @@ func makeInitials(name string, delimiter string) string {
 	names := strings.Split(name, delimiter)
 
 	for _, name := range names {
-		initials += string(name[0])
+		if name == "" {
+			continue
+		}
+		initial, _, _, _ := uniseg.FirstGraphemeClusterInString(name, -1)
+		initials += initial
 	}
 
 	return strings.ToUpper(initials)
@@ -58,49 +65,220 @@ func fmtContent(content string, replacePatterns map[string]string) string {
 	return content
 }
 
-func printMessage(room string, user string, content string, timestamp int) {
+// the markdown text fallback leaves inline and unboxed code in backticks, this is
+// coloured here and kept out of the later passes like the rest of the rendered code
+var rawCodePatterns = []*regexp.Regexp{
+	regexp.MustCompile("```((.|\\n)+?)```"),
+	// has to run after the fenced pattern (negative lookarounds are not supported)
+	regexp.MustCompile("`((.|\\n)+?)`"),
+}
+
+func renderRawCode(content string, resetColour string) string {
+	for _, reg := range rawCodePatterns {
+		content = replaceOutsideCode(content, func(text string) string {
+			return reg.ReplaceAllStringFunc(text, func(match string) string {
+				// without colours code keeps its backticks
+				if config.colourMode == "none" {
+					return protectCode(match)
+				}
+				return protectCode(config.codeColour + reg.FindStringSubmatch(match)[1] + resetColour)
+			})
+		})
+	}
+
+	return content
+}
+
+type mentionMatch struct {
+	self    bool
+	group   bool
+	keyword bool
+}
+
+func (m mentionMatch) any() bool {
+	return m.self || m.group || m.keyword
+}
+
+// matches code in raw message text, fenced blocks first
+var rawCode = regexp.MustCompile("```[\\s\\S]*?```|`[^`\\n]*`")
+
+// findMentions checks raw message text for mentions, anything pasted as code doesn't count
+func findMentions(content string) mentionMatch {
+	_, matched := highlightMentions(rawCode.ReplaceAllString(content, " "), "")
+	return matched
+}
+
+func highlightMentions(content string, resetColour string) (string, mentionMatch) {
+	pattern := `(^|\s)@[^\s]+`
+	if config.keywords != nil {
+		pattern = `(?i)(^|\s)@[^\s]+|` + config.keywords.String()
+	}
+	reg := regexp.MustCompile(pattern)
+
+	var matched mentionMatch
+
+	highlight := func(match string) string {
+		trimmed := strings.TrimLeftFunc(match, unicode.IsSpace)
+		leading := match[:len(match)-len(trimmed)]
+
+		if !strings.HasPrefix(trimmed, "@") {
+			matched.keyword = true
+			if config.colourMode == "none" {
+				return leading + "*" + trimmed + "*"
+			}
+			return leading + config.keywordColour + trimmed + resetColour
+		}
+
+		colour := config.notifyColour
+		personal := true
+
+		name := strings.TrimRight(trimmed[1:], ".,:;!?")
+
+		switch {
+		case name != "" && name == me.Username:
+			colour = config.mentionColour
+			matched.self = true
+		case name == "here" || name == "all":
+			colour = config.groupMentionColour
+			matched.group = true
+		default:
+			personal = false
+		}
+
+		if config.colourMode == "none" && personal {
+			return leading + "<" + trimmed + ">"
+		} else if config.colourMode == "none" {
+			return match
+		}
+
+		return leading + colour + " " + trimmed + " " + resetColour
+	}
+
+	content = replaceOutsideCode(content, func(text string) string {
+		return replaceOutsideAnsi(text, func(text string) string {
+			return reg.ReplaceAllStringFunc(text, highlight)
+		})
+	})
+
+	return content, matched
+}
+
+// displayState is what is remembered between printed messages, listings such as history
+// and search results have their own so that they don't carry over into the feed
+type displayState struct {
+	colours colourPicker
+	days    daySeparator
+	groups  messageGrouper
+}
+
+func (d *displayState) printMessage(matchedRoom roomSchema, message messageSchema) {
+	if message.isSystem() {
+		d.printSystemMessage(matchedRoom, message)
+		return
+	}
+
+	room := matchedRoom.prefix() + matchedRoom.DisplayName
+	user := message.Sender.Name
+	content := message.renderContent()
 
 	var contentIndent = config.timeWidth + config.roomWidth + config.userWidth + config.indentWidth + 2
 	resetColour := "\033[0m"
 
 	replacePatterns := map[string]string{
-		`( |^)(@[^\s]+)`:    fmt.Sprintf("${1}%s ${2} %s", config.notifyColour, resetColour),
-		`( |^)(#\d{6})`:     fmt.Sprintf("${1}%s${2}%s", config.ticketColour, resetColour),
-		"```((.|\\n)+?)```": fmt.Sprintf("%s${1}%s", config.codeColour, resetColour),
-		`(\n)`:              "\n" + strings.Repeat(" ", contentIndent),
-		`(\z)`:              resetColour,
+		`( |^)(#\d{6})`: fmt.Sprintf("${1}%s${2}%s", config.ticketColour, resetColour),
+		`(\z)`:          resetColour,
 	}
 
-	// weird but has to be executed after the other code highlighting regex (negative lookarounds are not supported)
-	replaceCodeline := map[string]string{
-		"`((.|\\n)+?)`": config.codeColour + "${1}" + resetColour,
+	if config.colourMode == "none" {
+		replacePatterns = map[string]string{}
 	}
 
-	userTextColour := config.userTextColours[len(user)%len(config.userTextColours)]
-	roomTextColour := config.roomTextColours[len(room)%len(config.roomTextColours)]
-	userBgColour := config.userBgColours[len(user)%len(config.userBgColours)]
-	roomBgColour := config.roomBgColours[len(room)%len(config.roomBgColours)]
-
-	userColour := userBgColour + userTextColour
-	roomColour := roomBgColour + roomTextColour
+	userColour := d.colours.userColour(message.Sender)
+	roomColour := d.colours.roomColour(matchedRoom)
 
 	user = makeShortName(user)
 
-	ts := time.UnixMilli(int64(timestamp))
-	timePretty := ts.Format(time.Kitchen)
-	timePretty = utils.PadRight(timePretty, " ", config.timeWidth)
+	ts := time.UnixMilli(int64(message.SentTS.TS))
+	timePretty := formatTime(ts)
+	if config.permalinks && config.hyperlinks && message.ID != "" {
+		timePretty = hyperlink(timePretty, permalink(matchedRoom, message)) + strings.Repeat(" ", utils.MaxInt(config.timeWidth-utils.StringWidth(timePretty), 0))
+	} else {
+		timePretty = utils.PadRight(timePretty, " ", config.timeWidth)
+	}
+
+	room = utils.Truncate(room, config.roomNameMaxWidth)
+	// leave at least a space between the name and the content
+	user = utils.Truncate(user, utils.MaxInt(config.userWidth-1, 1))
 
-	roomNameMaxIndex := utils.MinInt(config.roomNameMaxWidth, len(room))
-	room = room[:roomNameMaxIndex]
-	roomFmt := roomColour + " " + room + " " + resetColour
-	userFmt := userColour + user + resetColour
+	// pad outside of the colour codes so that only visible characters are counted
+	roomFmt := roomColour + " " + room + " " + resetColour + strings.Repeat(" ", utils.MaxInt(config.roomWidth-utils.StringWidth(room), 0))
+	userFmt := userColour + user + resetColour + strings.Repeat(" ", utils.MaxInt(config.userWidth-utils.StringWidth(user), 0))
 
-	roomFmtWidth := config.roomWidth + len(roomFmt) - len(room)
-	userFmtWidth := config.userWidth + len(userFmt) - len(user)
+	content = renderRawCode(content, resetColour)
+	content = replaceEmoji(content, resetColour)
+	content, mentioned := highlightMentions(content, resetColour)
+	content = replaceOutsideCode(content, func(text string) string {
+		return fmtContent(text, replacePatterns)
+	})
+	content = unprotectCode(content)
 
-	newLine := strings.Repeat(" ", config.indentWidth) + timePretty + utils.PadRight(roomFmt, " ", roomFmtWidth) + utils.PadRight(userFmt, " ", userFmtWidth) + fmtContent(fmtContent(content, replacePatterns), replaceCodeline)
+	separator, dayChanged := d.days.check(ts)
 
-	newLine = strings.Repeat("-", config.newLineMarkerWidth) + "\n" + newLine
+	if config.template != nil {
+		newLine := renderTemplate(templateData{
+			Time:         strings.TrimRight(timePretty, " "),
+			Room:         matchedRoom.DisplayName,
+			RoomType:     matchedRoom.kind(),
+			User:         message.Sender.Name,
+			Username:     message.Sender.Username,
+			Content:      content,
+			ThreadParent: matchedRoom.threadParent(message),
+			Server:       requests.Host,
+			userColour:   userColour,
+			roomColour:   roomColour,
+		})
+
+		if dayChanged {
+			newLine = separator + "\n" + newLine
+		}
+
+		printLine(newLine)
+		return
+	}
 
-	fmt.Println(newLine)
+	sameAuthor, grouped := false, false
+	if config.groupWindow > 0 && !dayChanged {
+		sameAuthor, grouped = d.groups.check(matchedRoom.ID, message.Sender.Username, ts)
+	}
+
+	header := strings.Repeat(" ", config.indentWidth) + timePretty + roomFmt + userFmt
+	if grouped {
+		header = strings.Repeat(" ", contentIndent)
+	}
+
+	newLine := header + wrapContent(content, contentIndent, int(terminalWidth.Load()))
+
+	// the marker is only drawn when the room or sender changes, unless the message needs highlighting
+	marker := strings.Repeat("-", config.newLineMarkerWidth)
+	if mentioned.any() && config.colourMode == "none" {
+		newLine = strings.Repeat("=", config.newLineMarkerWidth) + "\n" + newLine
+	} else if mentioned.any() {
+		newLine = config.mentionColour + marker + resetColour + "\n" + newLine
+	} else if !sameAuthor {
+		newLine = marker + "\n" + newLine
+	}
+
+	if dayChanged {
+		newLine = separator + "\n" + newLine
+	}
+
+	printLine(newLine)
+}
+
+// printLine prints a line of the feed, stripping any styling if colours are turned off
+func printLine(line string) {
+	if config.colourMode == "none" {
+		line = stripAnsi(line)
+	}
+	fmt.Println(line)
 }
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"regexp"
+	"sync"
+
+	"github.com/c-fandango/rocketchat-term/requests"
+)
+
+var emojiShortcode = regexp.MustCompile(`:([a-zA-Z0-9_+\-]+):`)
+
+// emojiTable maps the common rocketchat emoji shortcodes to unicode
+var emojiTable = map[string]string{
+	"+1":                    "👍",
+	"-1":                    "👎",
+	"100":                   "💯",
+	"alarm_clock":           "⏰",
+	"angry":                 "😠",
+	"arrow_down":            "⬇️",
+	"arrow_left":            "⬅️",
+	"arrow_right":           "➡️",
+	"arrow_up":              "⬆️",
+	"beer":                  "🍺",
+	"beers":                 "🍻",
+	"bell":                  "🔔",
+	"blush":                 "😊",
+	"boom":                  "💥",
+	"bug":                   "🐛",
+	"bulb":                  "💡",
+	"calendar":              "📆",
+	"cake":                  "🍰",
+	"checkered_flag":        "🏁",
+	"clap":                  "👏",
+	"clock":                 "🕐",
+	"coffee":                "☕",
+	"confused":              "😕",
+	"cool":                  "🆒",
+	"cry":                   "😢",
+	"crossed_fingers":       "🤞",
+	"disappointed":          "😞",
+	"dizzy":                 "💫",
+	"eyes":                  "👀",
+	"facepalm":              "🤦",
+	"fire":                  "🔥",
+	"fingers_crossed":       "🤞",
+	"flushed":               "😳",
+	"frowning":              "😦",
+	"ghost":                 "👻",
+	"gift":                  "🎁",
+	"grimacing":             "😬",
+	"grin":                  "😁",
+	"grinning":              "😀",
+	"hammer":                "🔨",
+	"hand":                  "✋",
+	"handshake":             "🤝",
+	"heart":                 "❤️",
+	"heart_eyes":            "😍",
+	"heavy_check_mark":      "✔️",
+	"heavy_minus_sign":      "➖",
+	"heavy_plus_sign":       "➕",
+	"hourglass":             "⌛",
+	"hugging":               "🤗",
+	"hugs":                  "🤗",
+	"hushed":                "😯",
+	"innocent":              "😇",
+	"information_source":    "ℹ️",
+	"joy":                   "😂",
+	"key":                   "🔑",
+	"kiss":                  "💋",
+	"laughing":              "😆",
+	"link":                  "🔗",
+	"lock":                  "🔒",
+	"mag":                   "🔍",
+	"mask":                  "😷",
+	"memo":                  "📝",
+	"moneybag":              "💰",
+	"muscle":                "💪",
+	"neutral_face":          "😐",
+	"no_entry":              "⛔",
+	"ok":                    "🆗",
+	"ok_hand":               "👌",
+	"open_mouth":            "😮",
+	"package":               "📦",
+	"partying_face":         "🥳",
+	"pencil":                "📝",
+	"pensive":               "😔",
+	"point_down":            "👇",
+	"point_left":            "👈",
+	"point_right":           "👉",
+	"point_up":              "☝️",
+	"pray":                  "🙏",
+	"pushpin":               "📌",
+	"question":              "❓",
+	"rage":                  "😡",
+	"raised_hands":          "🙌",
+	"recycle":               "♻️",
+	"relaxed":               "☺️",
+	"relieved":              "😌",
+	"rocket":                "🚀",
+	"rofl":                  "🤣",
+	"rolling_eyes":          "🙄",
+	"rotating_light":        "🚨",
+	"scream":                "😱",
+	"see_no_evil":           "🙈",
+	"shrug":                 "🤷",
+	"skull":                 "💀",
+	"sleeping":              "😴",
+	"slight_frown":          "🙁",
+	"slight_smile":          "🙂",
+	"slightly_smiling_face": "🙂",
+	"smile":                 "😄",
+	"smiley":                "😃",
+	"smirk":                 "😏",
+	"sob":                   "😭",
+	"sparkles":              "✨",
+	"star":                  "⭐",
+	"star_struck":           "🤩",
+	"stuck_out_tongue":      "😛",
+	"sunglasses":            "😎",
+	"sweat":                 "😓",
+	"sweat_smile":           "😅",
+	"tada":                  "🎉",
+	"thinking":              "🤔",
+	"thumbsdown":            "👎",
+	"thumbsup":              "👍",
+	"tired_face":            "😫",
+	"trophy":                "🏆",
+	"unamused":              "😒",
+	"upside_down":           "🙃",
+	"v":                     "✌️",
+	"warning":               "⚠️",
+	"wave":                  "👋",
+	"white_check_mark":      "✅",
+	"wink":                  "😉",
+	"worried":               "😟",
+	"wrench":                "🔧",
+	"x":                     "❌",
+	"yum":                   "😋",
+	"zap":                   "⚡",
+	"zipper_mouth":          "🤐",
+}
+
+type customEmojiSet struct {
+	mu    sync.Mutex
+	names map[string]bool
+}
+
+func (e *customEmojiSet) has(name string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.names[name]
+}
+
+// fetchCustomEmoji loads the names and aliases of the server's custom emoji
+func (e *customEmojiSet) fetchCustomEmoji() error {
+
+	params := make([]map[string]string, 0)
+
+	response, err := requests.GetRequest(`/api/v1/emoji-custom.list`, params)
+
+	log.Println(string(response))
+
+	if err != nil {
+		return err
+	}
+
+	emojiResult := struct {
+		Emojis struct {
+			Update []struct {
+				Name    string   `json:"name"`
+				Aliases []string `json:"aliases"`
+			} `json:"update"`
+		} `json:"emojis"`
+	}{}
+
+	err = json.Unmarshal(response, &emojiResult)
+
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.names = make(map[string]bool)
+
+	for _, emoji := range emojiResult.Emojis.Update {
+		e.names[emoji.Name] = true
+		for _, alias := range emoji.Aliases {
+			e.names[alias] = true
+		}
+	}
+
+	return nil
+}
+
+// replaceEmoji swaps emoji shortcodes for unicode, custom emoji are images on the
+// server so they are kept as shortcodes in their own colour, code is left as written
+func replaceEmoji(content string, resetColour string) string {
+	if config.keepShortcodes {
+		return content
+	}
+
+	replace := func(match string) string {
+		name := match[1 : len(match)-1]
+
+		if emoji, ok := emojiTable[name]; ok {
+			return emoji
+		}
+		if customEmoji.has(name) {
+			return config.emojiColour + match + resetColour
+		}
+		return match
+	}
+
+	return replaceOutsideCode(content, func(text string) string {
+		return replaceOutsideAnsi(text, func(text string) string {
+			return emojiShortcode.ReplaceAllStringFunc(text, replace)
+		})
+	})
+}
@@ -0,0 +1,608 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/c-fandango/rocketchat-term/requests"
+)
+
+// exportEntry is a message with the thread replies sent to it
+type exportEntry struct {
+	message messageSchema
+	replies []messageSchema
+}
+
+// threadEntries groups thread replies under their parent message, replies to messages
+// outside the export stay in place
+func threadEntries(messages []messageSchema) []*exportEntry {
+	entries := make([]*exportEntry, 0, len(messages))
+	parents := make(map[string]*exportEntry)
+
+	for _, message := range messages {
+		if parent, ok := parents[message.ThreadID]; ok {
+			parent.replies = append(parent.replies, message)
+			continue
+		}
+		entry := &exportEntry{message: message}
+		parents[message.ID] = entry
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// resolveNames fills in the display name of senders the server didn't send one for
+func resolveNames(messages []messageSchema) {
+	names := make(map[string]string)
+
+	for i, message := range messages {
+		if message.Sender.Name != "" || message.Sender.Username == "" {
+			continue
+		}
+
+		name, ok := names[message.Sender.Username]
+		if !ok {
+			name = fetchUserName(message.Sender.Username)
+			names[message.Sender.Username] = name
+		}
+		messages[i].Sender.Name = name
+	}
+}
+
+func fetchUserName(username string) string {
+	params := []map[string]string{
+		map[string]string{
+			"username": username,
+		},
+	}
+
+	response, err := requests.GetRequest(`/api/v1/users.info`, params)
+
+	log.Println(string(response))
+
+	if err != nil {
+		log.Println(err)
+		return ""
+	}
+
+	userResult := struct {
+		User userSchema `json:"user"`
+	}{}
+
+	err = json.Unmarshal(response, &userResult)
+
+	if err != nil {
+		log.Println(err)
+		return ""
+	}
+
+	return userResult.User.Name
+}
+
+func senderLabel(message messageSchema) string {
+	if message.Sender.Name == "" || message.Sender.Name == message.Sender.Username {
+		return "@" + message.Sender.Username
+	}
+	return message.Sender.Name + " (@" + message.Sender.Username + ")"
+}
+
+func exportTime(ts int) string {
+	return time.UnixMilli(int64(ts)).In(config.location).Format("2006-01-02 15:04")
+}
+
+// safeLink reports whether a link can be put in a shared document, only web and mail links
+// are allowed so that nobody can plant a script link in the room
+func safeLink(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+// attachmentURL returns the link of an attachment, file links on the server are relative,
+// links that aren't safe are dropped
+func attachmentURL(attachment attachmentSchema) string {
+	link := attachment.TitleLink
+	if link == "" {
+		link = attachment.ImageURL
+	}
+	if strings.HasPrefix(link, "/") && !strings.HasPrefix(link, "//") {
+		link = "https://" + requests.Host + link
+	}
+	if !safeLink(link) {
+		return ""
+	}
+	return link
+}
+
+func attachmentTitle(attachment attachmentSchema) string {
+	for _, title := range []string{attachment.Title, attachment.Description, attachment.Text} {
+		if title != "" {
+			return title
+		}
+	}
+	return "attachment"
+}
+
+func exportMarkdown(w io.Writer, room roomSchema, entries []*exportEntry, from string, to string) {
+	fmt.Fprintf(w, "# %s\n\n", room.DisplayName)
+	fmt.Fprintf(w, "_Exported from %s, %s to %s_\n\n", requests.Host, from, to)
+
+	writeMessage := func(message messageSchema, prefix string) {
+		if message.isSystem() {
+			fmt.Fprintf(w, "%s_%s · %s_\n\n", prefix, message.systemText(), exportTime(message.SentTS.TS))
+			return
+		}
+
+		lines := []string{
+			fmt.Sprintf("**%s** · %s", senderLabel(message), exportTime(message.SentTS.TS)),
+			"",
+		}
+		if message.Content != "" {
+			lines = append(lines, strings.Split(message.Content, "\n")...)
+			lines = append(lines, "")
+		}
+		for _, attachment := range message.Attachments {
+			if link := attachmentURL(attachment); link != "" {
+				lines = append(lines, fmt.Sprintf("- 📎 [%s](%s)", attachmentTitle(attachment), link))
+			} else {
+				lines = append(lines, "- 📎 "+attachmentTitle(attachment))
+			}
+		}
+		if len(message.Attachments) != 0 {
+			lines = append(lines, "")
+		}
+
+		for _, line := range lines {
+			fmt.Fprintln(w, strings.TrimRight(prefix+line, " "))
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.message.ThreadID != "" {
+			fmt.Fprintln(w, "_↳ reply in a thread_")
+			fmt.Fprintln(w)
+		}
+		writeMessage(entry.message, "")
+		for _, reply := range entry.replies {
+			writeMessage(reply, "> ")
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+const exportCSS = `body { font-family: sans-serif; max-width: 60em; margin: 2em auto; color: #222; }
+.message { margin: 1em 0; }
+.header { color: #666; font-size: 0.9em; }
+.sender { font-weight: bold; color: #222; }
+.content { white-space: pre-wrap; font-family: inherit; margin: 0.3em 0; }
+.thread { margin-left: 1.5em; padding-left: 1em; border-left: 3px solid #ddd; }
+.note { color: #666; font-style: italic; font-size: 0.9em; }
+pre, code { font-family: monospace; }`
+
+func exportHTML(w io.Writer, room roomSchema, entries []*exportEntry, from string, to string) {
+	resetColour := "\033[0m"
+
+	fmt.Fprintln(w, "<!DOCTYPE html>")
+	fmt.Fprintln(w, `<html><head><meta charset="utf-8">`)
+	fmt.Fprintf(w, "<title>%s</title>\n", html.EscapeString(room.DisplayName))
+	fmt.Fprintf(w, "<style>\n%s\n</style>\n</head><body>\n", exportCSS)
+	fmt.Fprintf(w, "<h1>%s</h1>\n", html.EscapeString(room.DisplayName))
+	fmt.Fprintf(w, "<p class=\"note\">Exported from %s, %s to %s</p>\n", html.EscapeString(requests.Host), html.EscapeString(from), html.EscapeString(to))
+
+	writeMessage := func(message messageSchema) {
+		if message.isSystem() {
+			fmt.Fprintf(w, "<div class=\"note\">%s · %s</div>\n", html.EscapeString(message.systemText()), exportTime(message.SentTS.TS))
+			return
+		}
+
+		fmt.Fprintln(w, `<div class="message">`)
+		fmt.Fprintf(w, "<div class=\"header\"><span class=\"sender\">%s</span> · %s</div>\n", html.EscapeString(senderLabel(message)), exportTime(message.SentTS.TS))
+
+		if message.Content != "" {
+			content := replaceEmoji(renderRawCode(message.renderContent(), resetColour), resetColour)
+			content = unprotectCode(content)
+			fmt.Fprintf(w, "<pre class=\"content\">%s</pre>\n", ansiToHTML(content))
+		}
+
+		for _, attachment := range message.Attachments {
+			title := html.EscapeString(attachmentTitle(attachment))
+			if link := attachmentURL(attachment); link != "" {
+				fmt.Fprintf(w, "<div>📎 <a href=\"%s\">%s</a></div>\n", html.EscapeString(link), title)
+			} else {
+				fmt.Fprintf(w, "<div>📎 %s</div>\n", title)
+			}
+		}
+		fmt.Fprintln(w, "</div>")
+	}
+
+	for _, entry := range entries {
+		if entry.message.ThreadID != "" {
+			fmt.Fprintln(w, `<div class="note">↳ reply in a thread</div>`)
+		}
+		writeMessage(entry.message)
+		if len(entry.replies) != 0 {
+			fmt.Fprintln(w, `<div class="thread">`)
+			for _, reply := range entry.replies {
+				writeMessage(reply)
+			}
+			fmt.Fprintln(w, "</div>")
+		}
+	}
+
+	fmt.Fprintln(w, "</body></html>")
+}
+
+type exportMessage struct {
+	ID          string             `json:"id"`
+	Type        string             `json:"type,omitempty"`
+	Time        string             `json:"time"`
+	Username    string             `json:"username"`
+	Name        string             `json:"name"`
+	Text        string             `json:"text"`
+	ThreadID    string             `json:"thread_id,omitempty"`
+	Attachments []exportAttachment `json:"attachments,omitempty"`
+	Replies     []exportMessage    `json:"replies,omitempty"`
+}
+
+type exportAttachment struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+func newExportMessage(message messageSchema) exportMessage {
+	output := exportMessage{
+		ID:       message.ID,
+		Type:     message.Type,
+		Time:     time.UnixMilli(int64(message.SentTS.TS)).In(config.location).Format(time.RFC3339),
+		Username: message.Sender.Username,
+		Name:     message.Sender.Name,
+		Text:     message.Content,
+		ThreadID: message.ThreadID,
+	}
+	if message.isSystem() {
+		output.Text = message.systemText()
+	}
+	for _, attachment := range message.Attachments {
+		output.Attachments = append(output.Attachments, exportAttachment{attachmentTitle(attachment), attachmentURL(attachment)})
+	}
+	return output
+}
+
+func exportJSON(w io.Writer, room roomSchema, entries []*exportEntry, from string, to string) error {
+	document := struct {
+		Server   string          `json:"server"`
+		RoomID   string          `json:"room_id"`
+		RoomName string          `json:"room_name"`
+		RoomType string          `json:"room_type"`
+		From     string          `json:"from"`
+		To       string          `json:"to"`
+		Messages []exportMessage `json:"messages"`
+	}{
+		Server:   requests.Host,
+		RoomID:   room.ID,
+		RoomName: room.DisplayName,
+		RoomType: room.Type,
+		From:     from,
+		To:       to,
+		Messages: make([]exportMessage, 0, len(entries)),
+	}
+
+	for _, entry := range entries {
+		message := newExportMessage(entry.message)
+		for _, reply := range entry.replies {
+			message.Replies = append(message.Replies, newExportMessage(reply))
+		}
+		document.Messages = append(document.Messages, message)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(document)
+}
+
+func runExportCommand(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Println("usage: rocketchat-term export --room <room> [flags]")
+		flags.PrintDefaults()
+	}
+
+	roomName := flags.String("room", "", "the room to export")
+	from := flags.String("from", "", "only export messages after this time, e.g 2h, 3d or 2006-01-02")
+	to := flags.String("to", "", "only export messages before this time, e.g 2h, 3d or 2006-01-02")
+	format := flags.String("format", "md", "the document format, one of md, html or json")
+	outputPath := flags.String("output", "-", "the file to write to, - for stdout")
+	limit := flags.Int("limit", 10000, "maximum number of messages to export")
+
+	flags.Parse(args)
+
+	if *roomName == "" {
+		flags.Usage()
+		return
+	}
+
+	if *format != "md" && *format != "html" && *format != "json" {
+		fmt.Println("invalid format, expecting one of md, html or json")
+		return
+	}
+
+	var fromTime, toTime time.Time
+	var err error
+
+	if *from != "" {
+		if fromTime, err = parseTimeArg(*from); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	if *to != "" {
+		if toTime, err = parseTimeArg(*to); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	err = restLogin(cachePath)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	var allRooms rooms
+
+	err = allRooms.fetchRooms()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	room, err := allRooms.findRoomByName(*roomName)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	history, err := room.fetchHistory(fromTime, toTime, *limit)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// deleted messages and suppressed system messages aren't part of the conversation
+	messages := make([]messageSchema, 0, len(history))
+	for _, message := range history {
+		if message.Type == "rm" || config.ignoreSystemTypes[message.Type] {
+			continue
+		}
+		messages = append(messages, message)
+	}
+
+	resolveNames(messages)
+	entries := threadEntries(messages)
+
+	fromLabel, toLabel := "the start", "now"
+	if !fromTime.IsZero() {
+		fromLabel = fromTime.In(config.location).Format("2006-01-02 15:04")
+	}
+	if !toTime.IsZero() {
+		toLabel = toTime.In(config.location).Format("2006-01-02 15:04")
+	}
+
+	var w io.Writer = os.Stdout
+	if *outputPath != "-" {
+		file, err := os.Create(*outputPath)
+		if err != nil {
+			fmt.Println("failed to create output file: ", err)
+			return
+		}
+		defer file.Close()
+		w = file
+	}
+
+	switch *format {
+	case "md":
+		exportMarkdown(w, room, entries, fromLabel, toLabel)
+	case "html":
+		// the document styles code and links whatever the terminal supports
+		config.colourMode = "truecolour"
+		config.hyperlinks = true
+		exportHTML(w, room, entries, fromLabel, toLabel)
+	case "json":
+		err = exportJSON(w, room, entries, fromLabel, toLabel)
+	}
+
+	if err != nil {
+		fmt.Println("failed to write export: ", err)
+	}
+}
+
+// htmlStyle is the text style set by ansi escape codes
+type htmlStyle struct {
+	bold      bool
+	dim       bool
+	italic    bool
+	underline bool
+	strike    bool
+	colour    string
+}
+
+func (s htmlStyle) css() string {
+	rules := make([]string, 0)
+
+	if s.bold {
+		rules = append(rules, "font-weight:bold")
+	}
+	if s.dim {
+		rules = append(rules, "opacity:0.6")
+	}
+	if s.italic {
+		rules = append(rules, "font-style:italic")
+	}
+	switch {
+	case s.underline && s.strike:
+		rules = append(rules, "text-decoration:underline line-through")
+	case s.underline:
+		rules = append(rules, "text-decoration:underline")
+	case s.strike:
+		rules = append(rules, "text-decoration:line-through")
+	}
+	if s.colour != "" {
+		rules = append(rules, "color:"+s.colour)
+	}
+
+	return strings.Join(rules, ";")
+}
+
+var basicColours = []string{
+	"#000000", "#cd0000", "#00cd00", "#cdcd00", "#0000ee", "#cd00cd", "#00cdcd", "#e5e5e5",
+	"#7f7f7f", "#ff0000", "#00ff00", "#ffff00", "#5c5cff", "#ff00ff", "#00ffff", "#ffffff",
+}
+
+// xtermColour converts a 256 colour palette number to a hex colour
+func xtermColour(n int) string {
+	switch {
+	case n < 0 || n > 255:
+		return ""
+	case n < 16:
+		return basicColours[n]
+	case n < 232:
+		levels := []int{0, 95, 135, 175, 215, 255}
+		n -= 16
+		return fmt.Sprintf("#%02x%02x%02x", levels[n/36], levels[n/6%6], levels[n%6])
+	}
+	grey := 8 + (n-232)*10
+	return fmt.Sprintf("#%02x%02x%02x", grey, grey, grey)
+}
+
+// apply updates the style with the parameters of an sgr escape code
+func (s *htmlStyle) apply(params []int) {
+	for i := 0; i < len(params); i++ {
+		switch p := params[i]; {
+		case p == 0:
+			*s = htmlStyle{}
+		case p == 1:
+			s.bold = true
+		case p == 2:
+			s.dim = true
+		case p == 3:
+			s.italic = true
+		case p == 4:
+			s.underline = true
+		case p == 9:
+			s.strike = true
+		case p == 22:
+			s.bold, s.dim = false, false
+		case p == 23:
+			s.italic = false
+		case p == 24:
+			s.underline = false
+		case p == 29:
+			s.strike = false
+		case p == 39:
+			s.colour = ""
+		case p >= 30 && p <= 37:
+			s.colour = basicColours[p-30]
+		case p >= 90 && p <= 97:
+			s.colour = basicColours[p-90+8]
+		case p == 38 || p == 48:
+			// extended colours, backgrounds are skipped over
+			colour := ""
+			if i+2 < len(params) && params[i+1] == 5 {
+				colour = xtermColour(params[i+2])
+				i += 2
+			} else if i+4 < len(params) && params[i+1] == 2 {
+				colour = fmt.Sprintf("#%02x%02x%02x", params[i+2], params[i+3], params[i+4])
+				i += 4
+			}
+			if p == 38 {
+				s.colour = colour
+			}
+		}
+	}
+}
+
+// ansiToHTML converts text styled with ansi escape codes and osc 8 hyperlinks to html
+func ansiToHTML(input string) string {
+	var b strings.Builder
+	var style htmlStyle
+	openCSS := ""
+	inLink := false
+
+	closeSpan := func() {
+		if openCSS != "" {
+			b.WriteString("</span>")
+			openCSS = ""
+		}
+	}
+
+	writeText := func(text string) {
+		if text == "" {
+			return
+		}
+		if css := style.css(); css != openCSS {
+			closeSpan()
+			if css != "" {
+				fmt.Fprintf(&b, "<span style=\"%s\">", css)
+				openCSS = css
+			}
+		}
+		b.WriteString(html.EscapeString(text))
+	}
+
+	last := 0
+
+	for _, loc := range ansiPattern.FindAllStringIndex(input, -1) {
+		writeText(input[last:loc[0]])
+		last = loc[1]
+
+		code := input[loc[0]:loc[1]]
+
+		switch {
+		case strings.HasPrefix(code, "\033]8;"):
+			// osc 8 is \033]8;params;url followed by a terminator
+			fields := strings.SplitN(strings.TrimRight(code[4:], "\033\\\007"), ";", 2)
+			closeSpan()
+			if inLink {
+				b.WriteString("</a>")
+				inLink = false
+			}
+			// links that aren't safe are left as plain text
+			if len(fields) == 2 && safeLink(fields[1]) {
+				fmt.Fprintf(&b, "<a href=\"%s\">", html.EscapeString(fields[1]))
+				inLink = true
+			}
+		case strings.HasPrefix(code, "\033[") && strings.HasSuffix(code, "m"):
+			params := make([]int, 0)
+			for _, field := range strings.Split(code[2:len(code)-1], ";") {
+				n, _ := strconv.Atoi(field)
+				params = append(params, n)
+			}
+			style.apply(params)
+		}
+	}
+
+	writeText(input[last:])
+	closeSpan()
+	if inLink {
+		b.WriteString("</a>")
+	}
+
+	return b.String()
+}
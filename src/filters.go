@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/c-fandango/rocketchat-term/requests"
+	"github.com/c-fandango/rocketchat-term/utils"
+)
+
+type messageFilter struct {
+	mu        sync.Mutex
+	hidden    int
+	userRoles map[string][]string
+}
+
+func compileUserPatterns(patterns []string) []*regexp.Regexp {
+	output := make([]*regexp.Regexp, len(patterns))
+
+	for i, pattern := range patterns {
+		reg, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			panic("invalid pattern in filters.ignore_users")
+		}
+		output[i] = reg
+	}
+	return output
+}
+
+func compileRoomTypes(types []string, key string) map[string]bool {
+	output := make(map[string]bool)
+
+	for _, name := range types {
+		if !utils.ContainsStr(roomTypes, name) {
+			panic("invalid room type in filters." + key)
+		}
+		output[name] = true
+	}
+	return output
+}
+
+// fetchRoles returns the roles of a user, looked up once and cached, the lookup is made
+// without holding the lock so a slow server doesn't hold up the feed
+func (f *messageFilter) fetchRoles(userID string) []string {
+	f.mu.Lock()
+	roles, ok := f.userRoles[userID]
+	f.mu.Unlock()
+
+	if ok {
+		return roles
+	}
+
+	roles = f.requestRoles(userID)
+
+	// failed lookups are cached as no roles so they aren't retried for every message
+	f.mu.Lock()
+	if f.userRoles == nil {
+		f.userRoles = make(map[string][]string)
+	}
+	f.userRoles[userID] = roles
+	f.mu.Unlock()
+
+	return roles
+}
+
+func (f *messageFilter) requestRoles(userID string) []string {
+
+	params := []map[string]string{
+		map[string]string{
+			"userId": userID,
+		},
+	}
+
+	response, err := requests.GetRequest(`/api/v1/users.info`, params)
+
+	log.Println(string(response))
+
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	userResult := struct {
+		User struct {
+			Roles []string `json:"roles"`
+		} `json:"user"`
+	}{}
+
+	err = json.Unmarshal(response, &userResult)
+
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	return userResult.User.Roles
+}
+
+func (f *messageFilter) isBot(message messageSchema) bool {
+	if message.Bot != nil || message.Alias != "" {
+		return true
+	}
+
+	if message.Sender.ID == "" {
+		return false
+	}
+
+	for _, role := range f.fetchRoles(message.Sender.ID) {
+		if role == "bot" {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *messageFilter) isHidden(room roomSchema, message messageSchema) bool {
+	kind := room.kind()
+
+	hide := config.ignoreRoomTypes[kind] || (len(config.onlyRoomTypes) != 0 && !config.onlyRoomTypes[kind])
+
+	if !hide && message.isSystem() {
+		hide = config.ignoreSystemTypes[message.Type]
+	}
+
+	if !hide {
+		hide = config.ignoreBots && f.isBot(message)
+	}
+
+	for _, reg := range config.ignoreUsers {
+		if hide {
+			break
+		}
+		hide = reg.MatchString(message.Sender.Username)
+	}
+
+	if hide {
+		f.mu.Lock()
+		f.hidden++
+		f.mu.Unlock()
+	}
+	return hide
+}
+
+func (f *messageFilter) report() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.hidden == 0 {
+		return
+	}
+
+	plural := "s"
+	if f.hidden == 1 {
+		plural = ""
+	}
+
+	feed.groups.reset()
+	printNotice(strings.Repeat("-", config.newLineMarkerWidth))
+	printNotice(fmt.Sprintf("%s%d message%s hidden by filters", strings.Repeat(" ", config.indentWidth), f.hidden, plural))
+
+	f.hidden = 0
+}
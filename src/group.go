@@ -0,0 +1,42 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// messageGrouper tracks the previous message so consecutive messages from the same
+// sender in the same room can be printed under one header
+type messageGrouper struct {
+	mu     sync.Mutex
+	room   string
+	sender string
+	last   time.Time
+}
+
+// check reports whether a message has the same room and sender as the one before it,
+// and whether it arrived within the grouping window
+func (g *messageGrouper) check(room string, sender string, ts time.Time) (bool, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	sameAuthor := room == g.room && sender == g.sender
+	window := time.Duration(config.groupWindow) * time.Second
+	grouped := sameAuthor && ts.Sub(g.last) <= window
+
+	g.room = room
+	g.sender = sender
+	g.last = ts
+
+	return sameAuthor, grouped
+}
+
+// reset forgets the previous message, after a line that isn't a message the next message
+// always gets a header
+func (g *messageGrouper) reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.room = ""
+	g.sender = ""
+}
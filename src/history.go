@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/c-fandango/rocketchat-term/requests"
+	"github.com/c-fandango/rocketchat-term/utils"
+)
+
+const historyTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// historyEndpoint returns the history endpoint for the type of room
+func (r roomSchema) historyEndpoint() string {
+	switch r.Type {
+	case "p":
+		return `/api/v1/groups.history`
+	case "d":
+		return `/api/v1/im.history`
+	}
+	return `/api/v1/channels.history`
+}
+
+// fetchHistory fetches up to limit messages sent in the room between since and until,
+// paging back from the newest message, and returns them oldest first, zero times leave
+// that end of the range open
+func (r roomSchema) fetchHistory(since time.Time, until time.Time, limit int) ([]messageSchema, error) {
+	const pageSize = 100
+
+	messages := make([]messageSchema, 0)
+	latest := ""
+	if !until.IsZero() {
+		latest = until.UTC().Format(historyTimeLayout)
+	}
+
+	for len(messages) < limit {
+		count := utils.MinInt(pageSize, limit-len(messages))
+
+		query := map[string]string{
+			"roomId": r.ID,
+			"count":  strconv.Itoa(count),
+		}
+		if latest != "" {
+			query["latest"] = latest
+		}
+		if !since.IsZero() {
+			query["oldest"] = since.UTC().Format(historyTimeLayout)
+		}
+
+		response, err := requests.GetRequest(r.historyEndpoint(), []map[string]string{query})
+
+		log.Println(string(response))
+
+		if err != nil {
+			return nil, err
+		}
+
+		historyResult := struct {
+			Messages []messageSchema `json:"messages"`
+		}{}
+
+		err = json.Unmarshal(response, &historyResult)
+
+		if err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, historyResult.Messages...)
+
+		if len(historyResult.Messages) < count {
+			break
+		}
+
+		// pages are newest first so the next page ends at the oldest message seen
+		oldest := historyResult.Messages[len(historyResult.Messages)-1].SentTS.TS
+		latest = time.UnixMilli(int64(oldest)).UTC().Format(historyTimeLayout)
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	return messages, nil
+}
+
+// printHistory prints the past messages of the named room with the feed formatting
+func printHistory(allRooms *rooms, roomName string, since time.Time, limit int) error {
+	room, err := allRooms.findRoomByName(roomName)
+	if err != nil {
+		return err
+	}
+
+	messages, err := room.fetchHistory(since, time.Time{}, limit)
+	if err != nil {
+		return err
+	}
+
+	if len(messages) == 0 {
+		fmt.Println("no messages found")
+		return nil
+	}
+
+	var listing displayState
+	for _, message := range messages {
+		if message.Type == "rm" || filter.isHidden(room, message) {
+			continue
+		}
+		listing.printMessage(room, message)
+	}
+	// the next message in the feed gets its own header
+	feed.groups.reset()
+
+	return nil
+}
+
+func runHistoryCommand(args []string) {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Println("usage: rocketchat-term history <room> [flags]")
+		flags.PrintDefaults()
+	}
+
+	since := flags.String("since", "", "only show messages after this time, e.g 2h, 3d or 2006-01-02")
+	limit := flags.Int("limit", 200, "maximum number of messages to show")
+
+	// the room may come before or after the flags
+	roomName := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		roomName = args[0]
+		args = args[1:]
+	}
+
+	flags.Parse(args)
+
+	if roomName == "" {
+		roomName = flags.Arg(0)
+	}
+	if roomName == "" {
+		flags.Usage()
+		return
+	}
+
+	var sinceTime time.Time
+	var err error
+
+	if *since != "" {
+		if sinceTime, err = parseTimeArg(*since); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	err = restLogin(cachePath)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	var allRooms rooms
+
+	err = allRooms.fetchRooms()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	updateTerminalWidth()
+
+	err = printHistory(&allRooms, roomName, sinceTime, *limit)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/c-fandango/rocketchat-term/requests"
+	"golang.org/x/term"
+)
+
+// hyperlinksSupported guesses from the environment whether the terminal understands
+// osc 8 hyperlinks, terminals that don't may print the escape codes as garbage
+func hyperlinksSupported() bool {
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		return false
+	}
+
+	switch os.Getenv("TERM_PROGRAM") {
+	case "iTerm.app", "WezTerm", "vscode", "ghostty", "Hyper", "tabby":
+		return true
+	}
+
+	if vte, err := strconv.Atoi(os.Getenv("VTE_VERSION")); err == nil && vte >= 5000 {
+		return true
+	}
+
+	for _, env := range []string{"KITTY_WINDOW_ID", "WT_SESSION", "KONSOLE_VERSION", "DOMTERM"} {
+		if os.Getenv(env) != "" {
+			return true
+		}
+	}
+
+	termName := os.Getenv("TERM")
+	for _, name := range []string{"kitty", "alacritty", "foot", "wezterm", "contour"} {
+		if strings.Contains(termName, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hyperlink(text string, url string) string {
+	return fmt.Sprintf("\033]8;;%s\033\\%s\033]8;;\033\\", url, text)
+}
+
+// permalink builds the web client url of a message
+func permalink(room roomSchema, message messageSchema) string {
+	switch room.Type {
+	case "p":
+		return fmt.Sprintf("https://%s/group/%s?msg=%s", requests.Host, room.Name, message.ID)
+	case "d":
+		return fmt.Sprintf("https://%s/direct/%s?msg=%s", requests.Host, room.ID, message.ID)
+	}
+	return fmt.Sprintf("https://%s/channel/%s?msg=%s", requests.Host, room.Name, message.ID)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -9,6 +10,8 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/c-fandango/rocketchat-term/creds"
@@ -21,45 +24,183 @@ var homeDir, _ = os.UserHomeDir()
 var dataDir = homeDir + "/.rocketchat-term"
 var cachePath = dataDir + "/cache.json"
 var configPath = dataDir + "/rocketchat-term.yaml"
+var archivePath = dataDir + "/archive.db"
 var config configSchema
+var noColour bool
+var outputFormat string
+var filter messageFilter
+var me userSchema
+var notifier messageNotifier
+var reads readQueue
+var customEmoji customEmojiSet
+var feed displayState
+var archive = messageArchive{path: archivePath}
 
 type userSchema struct {
-	ID       string `json:"id"`
+	ID       string `json:"_id"`
 	Username string `json:"username"`
 	Name     string `json:"name"`
 }
 
+func (u *userSchema) fetchMe() error {
+
+	params := make([]map[string]string, 0)
+
+	response, err := requests.GetRequest(`/api/v1/me`, params)
+
+	log.Println(string(response))
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(response, u)
+}
+
+type botSchema struct {
+	ID string `json:"i"`
+}
+
 type timestampSchema struct {
 	TS int `json:"$date"`
 }
 
+// UnmarshalJSON accepts both the {"$date": ms} form sent over the websocket and the
+// ISO 8601 strings returned by the REST api, null leaves the timestamp unchanged
+func (t *timestampSchema) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var iso string
+	if err := json.Unmarshal(data, &iso); err == nil {
+		ts, err := time.Parse(time.RFC3339, iso)
+		if err != nil {
+			return err
+		}
+		t.TS = int(ts.UnixMilli())
+		return nil
+	}
+
+	date := struct {
+		TS int `json:"$date"`
+	}{}
+
+	err := json.Unmarshal(data, &date)
+	t.TS = date.TS
+
+	return err
+}
+
 type messageSchema struct {
-	ID       string          `json:"_id"`
-	RoomID   string          `json:"rid"`
-	Content  string          `json:"msg"`
-	SentTS   timestampSchema `json:"ts"`
-	UpdateTS timestampSchema `json:"_updatedAt"`
-	Sender   userSchema      `json:"u"`
+	ID          string                    `json:"_id"`
+	RoomID      string                    `json:"rid"`
+	Content     string                    `json:"msg"`
+	SentTS      timestampSchema           `json:"ts"`
+	UpdateTS    timestampSchema           `json:"_updatedAt"`
+	Sender      userSchema                `json:"u"`
+	Alias       string                    `json:"alias"`
+	Bot         *botSchema                `json:"bot"`
+	Markdown    []mdNode                  `json:"md"`
+	ThreadID    string                    `json:"tmid"`
+	Type        string                    `json:"t"`
+	EditedAt    *timestampSchema          `json:"editedAt"`
+	Reactions   map[string]reactionSchema `json:"reactions"`
+	Attachments []attachmentSchema        `json:"attachments"`
+}
+
+type attachmentSchema struct {
+	Title       string `json:"title"`
+	TitleLink   string `json:"title_link"`
+	Text        string `json:"text"`
+	Description string `json:"description"`
+	ImageURL    string `json:"image_url"`
 }
 
 type roomSchema struct {
-	ID        string   `json:"_id"`
-	ReadOnly  bool     `json:"ro"`
-	Name      string   `json:"name"`
-	Fname     string   `json:"fname"`
-	Topic     string   `json:"topic"`
-	Usernames []string `json:"usernames"`
-	Messages  []messageSchema
+	ID          string   `json:"_id"`
+	Type        string   `json:"t"`
+	ReadOnly    bool     `json:"ro"`
+	Name        string   `json:"name"`
+	Fname       string   `json:"fname"`
+	Topic       string   `json:"topic"`
+	ParentID    string   `json:"prid"`
+	Archived    bool     `json:"archived"`
+	Usernames   []string `json:"usernames"`
+	Messages    []messageSchema
+	DisplayName string `json:"-"`
+	Unread      int    `json:"-"`
+	Mentions    int    `json:"-"`
 }
 
 func (r *roomSchema) makeName() {
 	if r.Topic != "" {
-		r.Name = r.Topic
+		r.DisplayName = r.Topic
 	} else if r.Fname != "" {
-		r.Name = r.Fname
-	} else if r.Name == "" {
-		r.Name = initialiseNames(r.Usernames)
+		r.DisplayName = r.Fname
+	} else if r.Name != "" {
+		r.DisplayName = r.Name
+	} else {
+		r.DisplayName = initialiseNames(r.Usernames)
+	}
+}
+
+// roomTypes are the kinds of room returned by kind
+var roomTypes = []string{"channel", "private", "direct", "discussion", "livechat"}
+
+// kind names the type of the room, discussions are rooms of any type with a parent room
+func (r roomSchema) kind() string {
+	switch {
+	case r.ParentID != "":
+		return "discussion"
+	case r.Type == "p":
+		return "private"
+	case r.Type == "d":
+		return "direct"
+	case r.Type == "l":
+		return "livechat"
 	}
+	return "channel"
+}
+
+// prefix returns the marker shown before the room name in the feed
+func (r roomSchema) prefix() string {
+	if !config.roomPrefixes {
+		return ""
+	}
+
+	switch r.kind() {
+	case "discussion":
+		return "💬"
+	case "private":
+		return "🔒"
+	case "direct":
+		return "@"
+	case "livechat":
+		return "☎"
+	}
+	return "#"
+}
+
+// threadParent returns the text of the message a thread reply belongs to if it's
+// in the feed, otherwise the id of the parent message
+func (r roomSchema) threadParent(message messageSchema) string {
+	if message.ThreadID == "" {
+		return ""
+	}
+
+	for _, parent := range r.Messages {
+		if parent.ID == message.ThreadID {
+			return parent.Content
+		}
+	}
+	return message.ThreadID
+}
+
+// roomMessage is a message together with the room it was sent in
+type roomMessage struct {
+	room    roomSchema
+	message messageSchema
 }
 
 type errorResponse struct {
@@ -176,6 +317,7 @@ func (a *authResponse) handleResponse(response []byte) error {
 }
 
 type rooms struct {
+	mu    sync.Mutex
 	Rooms []roomSchema `json:"update"`
 }
 
@@ -191,6 +333,9 @@ func (r *rooms) fetchRooms() error {
 		return err
 	}
 
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	err = json.Unmarshal(response, &r)
 
 	if err != nil {
@@ -208,15 +353,95 @@ func (r *rooms) addMessage(message messageSchema) (roomSchema, error) {
 	if message.RoomID == "" {
 		return roomSchema{}, fmt.Errorf("message has no room id")
 	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	for i, room := range r.Rooms {
 		if room.ID == message.RoomID {
 			r.Rooms[i].Messages = append(r.Rooms[i].Messages, message)
+			r.Rooms[i].countUnread(message)
 			return room, nil
 		}
 	}
 	return roomSchema{}, fmt.Errorf("failed to match room")
 }
 
+// updateMessage replaces the held copy of a message that has been updated, returning the
+// copy from before the update
+func (r *rooms) updateMessage(message messageSchema) (messageSchema, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, room := range r.Rooms {
+		if room.ID != message.RoomID {
+			continue
+		}
+		for j, held := range room.Messages {
+			if held.ID == message.ID {
+				r.Rooms[i].Messages[j] = message
+				return held, true
+			}
+		}
+	}
+	return messageSchema{}, false
+}
+
+// findMessage returns the held copy of a message
+func (r *rooms) findMessage(roomID string, messageID string) (messageSchema, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, room := range r.Rooms {
+		if room.ID != roomID {
+			continue
+		}
+		for _, held := range room.Messages {
+			if held.ID == messageID {
+				return held, true
+			}
+		}
+	}
+	return messageSchema{}, false
+}
+
+func (r *rooms) roomIDs() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]string, len(r.Rooms))
+	for i, room := range r.Rooms {
+		ids[i] = room.ID
+	}
+	return ids
+}
+
+func (r *rooms) findRoom(roomID string) (roomSchema, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, room := range r.Rooms {
+		if room.ID == roomID {
+			return room, nil
+		}
+	}
+	return roomSchema{}, fmt.Errorf("failed to match room")
+}
+
+// findRoomByName looks up a room by its name or the name shown in the feed
+func (r *rooms) findRoomByName(name string) (roomSchema, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name = strings.TrimPrefix(name, "#")
+
+	for _, room := range r.Rooms {
+		if strings.EqualFold(name, room.Name) || strings.EqualFold(name, room.Fname) || strings.EqualFold(name, room.DisplayName) {
+			return room, nil
+		}
+	}
+	return roomSchema{}, fmt.Errorf("no room named %s", name)
+}
+
 func (r *rooms) fetchNewRoom(roomID string) (roomSchema, error) {
 
 	params := []map[string]string{
@@ -244,6 +469,10 @@ func (r *rooms) fetchNewRoom(roomID string) (roomSchema, error) {
 	}
 
 	roomResult.Room.makeName()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	r.Rooms = append(r.Rooms, roomResult.Room)
 
 	return roomResult.Room, nil
@@ -258,7 +487,9 @@ type subscription struct {
 }
 
 func (s *subscription) handleResponse(response []byte, allRooms *rooms) error {
-	const newMessageAllowedDelayMS = 400
+	// unmarshal reuses the elements of an existing slice, which would leave fields
+	// of the previous messages set
+	s.Fields.Messages = nil
 
 	err := json.Unmarshal(response, s)
 
@@ -268,11 +499,17 @@ func (s *subscription) handleResponse(response []byte, allRooms *rooms) error {
 
 	for _, message := range s.Fields.Messages {
 
-		if message.UpdateTS.TS > message.SentTS.TS+newMessageAllowedDelayMS {
-			continue
-		}
+		previous, seen := allRooms.updateMessage(message)
 
-		matchedRoom, err := allRooms.addMessage(message)
+		event := message.event(previous, seen)
+
+		var matchedRoom roomSchema
+
+		if event == "message" || event == "room_join" {
+			matchedRoom, err = allRooms.addMessage(message)
+		} else {
+			matchedRoom, err = allRooms.findRoom(message.RoomID)
+		}
 
 		if err != nil && err.Error() == "failed to match room" {
 			log.Println(err)
@@ -283,8 +520,36 @@ func (s *subscription) handleResponse(response []byte, allRooms *rooms) error {
 			}
 		}
 
-		if message.Content != "" {
-			printMessage(matchedRoom.Name, message.Sender.Name, message.Content, message.SentTS.TS)
+		if config.archiveEnabled {
+			archive.add(matchedRoom, message)
+		}
+
+		// updates to existing messages are only shown in jsonl output
+		if outputFormat != "jsonl" && event != "message" && event != "room_join" {
+			continue
+		}
+
+		if filter.isHidden(matchedRoom, message) {
+			continue
+		}
+
+		if outputFormat == "jsonl" {
+			printJSONEvent(event, matchedRoom, message)
+			if event == "message" {
+				notifier.notify(matchedRoom, message)
+			}
+			continue
+		}
+
+		if message.Content != "" || message.isSystem() {
+			feed.printMessage(matchedRoom, message)
+			if !message.isSystem() {
+				notifier.notify(matchedRoom, message)
+			}
+
+			if config.markDisplayed && matchedRoom.ID != "" {
+				reads.add(matchedRoom.ID, allRooms)
+			}
 		}
 	}
 
@@ -319,7 +584,24 @@ func (s *subscription) constructRequest(roomID string) string {
 
 func main() {
 
-	config.loadConf(configPath)
+	flag.BoolVar(&noColour, "no-colour", false, "print plain text without colours or styling")
+	flag.BoolVar(&noColour, "no-color", false, "alias of -no-colour")
+	flag.StringVar(&outputFormat, "output", "text", "output format, text or jsonl")
+	flag.Parse()
+
+	config.loadConf(configPath, "")
+
+	if outputFormat != "text" && outputFormat != "jsonl" {
+		fmt.Printf("unknown output format %s, expecting text or jsonl\n", outputFormat)
+		return
+	}
+
+	// terminal escapes would corrupt the json lines on stdout, and don't belong in plain
+	// text output going to a pager or a file
+	if outputFormat == "jsonl" || config.colourMode == "none" {
+		config.notifyBell = false
+		config.notifyTitle = false
+	}
 
 	if config.debug {
 		log.SetOutput(os.Stdout)
@@ -327,6 +609,23 @@ func main() {
 		log.SetOutput(io.Discard)
 	}
 
+	switch flag.Arg(0) {
+	case "theme":
+		runThemeCommand(flag.Args()[1:])
+		return
+	case "search":
+		runSearchCommand(flag.Args()[1:])
+		return
+	case "history":
+		runHistoryCommand(flag.Args()[1:])
+		return
+	case "export":
+		runExportCommand(flag.Args()[1:])
+		return
+	}
+
+	watchResize()
+
 	credentials, err := getCredentials(cachePath)
 	if err != nil {
 		log.Println(err)
@@ -347,17 +646,34 @@ func main() {
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt)
 
+	hiddenReport := time.NewTicker(time.Duration(config.hiddenReportInterval) * time.Second)
+	defer hiddenReport.Stop()
+
 	go func() {
 		defer close(done)
 		var allRooms rooms
 		var auth authResponse
 		var roomSub subscription
 		roomSub.Collection = "stream-room-messages"
+		var changes roomChanges
+		changes.Collection = "stream-notify-user"
+		var deletes messageDeletes
+		deletes.Collection = "stream-notify-room"
 		pongMessage := `{"msg": "pong"}`
 		connectMessage := `{"msg": "connect","version": "1","support": ["1"]}`
 		auth.host = credentials["host"]
 		messageOut <- connectMessage
 
+		// deletes are only reported in jsonl output, each room needs its own subscription
+		subscribeDeletes := func() {
+			if outputFormat != "jsonl" {
+				return
+			}
+			for _, request := range deletes.subscribeRooms(&allRooms) {
+				messageOut <- request
+			}
+		}
+
 		// TODO don't busy loop
 		for {
 			_, response, err := c.ReadMessage()
@@ -383,30 +699,70 @@ func main() {
 			} else if data.ID == auth.ID && data.Message == "result" {
 				err := auth.handleResponse(response)
 				if err != nil {
-					fmt.Println(err)
+					printNotice(err)
 					return
 				}
 
-				fmt.Println("authenticated")
+				printNotice("authenticated")
 				requests.Host = auth.host
 				requests.Token = auth.Result.Token
 				requests.User = auth.Result.User
 
+				err = me.fetchMe()
+
+				if err != nil {
+					log.Println(err)
+				}
+
 				err = allRooms.fetchRooms()
 
 				if err != nil {
-					fmt.Println(err)
+					printNotice(err)
 					return
 				}
 
+				err = allRooms.fetchSubscriptions()
+
+				if err != nil {
+					log.Println(err)
+				}
+
+				err = customEmoji.fetchCustomEmoji()
+
+				if err != nil {
+					log.Println(err)
+				}
+
 				messageOut <- roomSub.constructRequest("__my_messages__")
+				messageOut <- changes.constructRequest(auth.Result.User, "rooms-changed")
+				messageOut <- changes.constructRequest(auth.Result.User, "subscriptions-changed")
+				subscribeDeletes()
+
+				// command output would corrupt the json lines on stdout
+				if outputFormat != "jsonl" {
+					go watchInput(&allRooms)
+				}
 
 			} else if data.Collection == roomSub.Collection && data.Message == "changed" {
 				err := roomSub.handleResponse(response, &allRooms)
 				if err != nil {
-					fmt.Println(err)
+					printNotice(err)
 					return
 				}
+				subscribeDeletes()
+
+			} else if data.Collection == changes.Collection && data.Message == "changed" {
+				err := changes.handleResponse(response, &allRooms)
+				if err != nil {
+					log.Println(err)
+				}
+				subscribeDeletes()
+
+			} else if data.Collection == deletes.Collection && data.Message == "changed" {
+				err := deletes.handleResponse(response, &allRooms)
+				if err != nil {
+					log.Println(err)
+				}
 
 			} else if data.Message == "ping" {
 				messageOut <- pongMessage
@@ -425,14 +781,16 @@ func main() {
 			err := c.WriteMessage(websocket.TextMessage, []byte(m))
 
 			if err != nil {
-				fmt.Println("error sending websocket message ", err)
+				printNotice("error sending websocket message ", err)
 			}
+		case <-hiddenReport.C:
+			filter.report()
 		case <-interrupt:
 
 			err := c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
 
 			if err != nil {
-				fmt.Println("error closing websocket", err)
+				printNotice("error closing websocket", err)
 			}
 			select {
 			case <-done:
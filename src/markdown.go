@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const boldOn = "\033[1m"
+const boldOff = "\033[22m"
+const italicOn = "\033[3m"
+const italicOff = "\033[23m"
+const underlineOn = "\033[4m"
+const underlineOff = "\033[24m"
+const strikeOn = "\033[9m"
+const strikeOff = "\033[29m"
+const dimOn = "\033[2m"
+const dimOff = "\033[22m"
+
+var quoteMarker = dimOn + "│" + dimOff + " "
+
+// mdNode is a node of the message markdown tree the server sends in the md field
+type mdNode struct {
+	Type      string          `json:"type"`
+	Value     json.RawMessage `json:"value"`
+	Level     int             `json:"level"`
+	Number    int             `json:"number"`
+	Language  string          `json:"language"`
+	Status    bool            `json:"status"`
+	ShortCode string          `json:"shortCode"`
+	Unicode   string          `json:"unicode"`
+}
+
+// children decodes the value of a node, which is either a list of nodes or a single node
+func (n mdNode) children() []mdNode {
+	var nodes []mdNode
+	if err := json.Unmarshal(n.Value, &nodes); err == nil {
+		return nodes
+	}
+
+	var node mdNode
+	if err := json.Unmarshal(n.Value, &node); err == nil && node.Type != "" {
+		return []mdNode{node}
+	}
+
+	return nil
+}
+
+// text returns the plain text held by a node or its first child
+func (n mdNode) text() string {
+	var text string
+	if err := json.Unmarshal(n.Value, &text); err == nil {
+		return text
+	}
+
+	var output string
+	for _, child := range n.children() {
+		output += child.text()
+	}
+	return output
+}
+
+// styled applies a terminal style to text, or the markdown marker if colours are off
+func styled(text string, on string, off string, marker string) string {
+	if config.colourMode == "none" {
+		return marker + text + marker
+	}
+	return on + text + off
+}
+
+func renderLink(label string, url string) string {
+	if label == "" {
+		label = url
+	}
+	if config.hyperlinks {
+		return hyperlink(underlineOn+label+underlineOff, url)
+	}
+	if label == url {
+		return underlineOn + url + underlineOff
+	}
+	return underlineOn + label + underlineOff + " " + dimOn + "(" + url + ")" + dimOff
+}
+
+func renderMarkdownTree(blocks []mdNode) string {
+	lines := make([]string, len(blocks))
+
+	for i, block := range blocks {
+		lines[i] = renderBlock(block)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func renderBlock(block mdNode) string {
+	switch block.Type {
+	case "PARAGRAPH", "BIG_EMOJI":
+		return renderInline(block.children())
+	case "HEADING":
+		return boldOn + underlineOn + renderInline(block.children()) + underlineOff + boldOff
+	case "QUOTE":
+		quoted := strings.Split(renderMarkdownTree(block.children()), "\n")
+		return quoteMarker + strings.Join(quoted, "\n"+quoteMarker)
+	case "CODE":
+		codeLines := make([]string, 0)
+		for _, line := range block.children() {
+			codeLines = append(codeLines, line.text())
+		}
+		return renderCodeBlock(block.Language, strings.Join(codeLines, "\n"))
+	case "UNORDERED_LIST", "ORDERED_LIST", "TASKS":
+		items := make([]string, 0)
+		for i, item := range block.children() {
+			bullet := "• "
+			switch {
+			case block.Type == "TASKS" && item.Status:
+				bullet = "[x] "
+			case block.Type == "TASKS":
+				bullet = "[ ] "
+			case block.Type == "ORDERED_LIST" && item.Number != 0:
+				bullet = fmt.Sprintf("%d. ", item.Number)
+			case block.Type == "ORDERED_LIST":
+				bullet = fmt.Sprintf("%d. ", i+1)
+			}
+			items = append(items, bullet+renderInline(item.children()))
+		}
+		return strings.Join(items, "\n")
+	case "LINE_BREAK":
+		return ""
+	}
+
+	return renderInline(block.children())
+}
+
+func renderInline(nodes []mdNode) string {
+	resetColour := "\033[0m"
+
+	var output string
+
+	for _, node := range nodes {
+		switch node.Type {
+		case "PLAIN_TEXT":
+			output += node.text()
+		case "BOLD":
+			output += styled(renderInline(node.children()), boldOn, boldOff, "*")
+		case "ITALIC":
+			output += styled(renderInline(node.children()), italicOn, italicOff, "_")
+		case "STRIKE":
+			output += styled(renderInline(node.children()), strikeOn, strikeOff, "~")
+		case "INLINE_CODE":
+			if config.colourMode == "none" {
+				output += protectCode("`" + node.text() + "`")
+			} else {
+				output += protectCode(config.codeColour + node.text() + resetColour)
+			}
+		case "MENTION_USER":
+			output += "@" + node.text()
+		case "MENTION_CHANNEL":
+			output += "#" + node.text()
+		case "EMOJI":
+			if node.Unicode != "" && !config.keepShortcodes {
+				output += node.Unicode
+			} else {
+				output += ":" + node.ShortCode + ":"
+			}
+		case "LINK":
+			link := struct {
+				Src   mdNode          `json:"src"`
+				Label json.RawMessage `json:"label"`
+			}{}
+			if err := json.Unmarshal(node.Value, &link); err != nil {
+				continue
+			}
+			output += renderLink(renderInline(mdNode{Value: link.Label}.children()), link.Src.text())
+		default:
+			if children := node.children(); children != nil {
+				output += renderInline(children)
+			} else {
+				output += node.text()
+			}
+		}
+	}
+
+	return output
+}
+
+var mdFence = regexp.MustCompile("^```([\\w+#.-]*)\\s*$")
+var mdHeading = regexp.MustCompile(`^#{1,6} +(.+)$`)
+var mdQuote = regexp.MustCompile(`^> ?(.*)$`)
+var mdUnordered = regexp.MustCompile(`^(\s*)[-*] +(.+)$`)
+var mdOrdered = regexp.MustCompile(`^(\s*)(\d+)[.)] +(.+)$`)
+
+// matches markdown links and bare urls, trailing punctuation isn't part of a bare url
+var mdLink = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)|(https?://[^\s<>()]*[^\s<>().,;:!?'"])`)
+var mdBold = regexp.MustCompile(`(^|[^\w*])\*([^*\s][^*\n]*?)\*`)
+var mdItalic = regexp.MustCompile(`(^|[^\w_])_([^_\s][^_\n]*?)_`)
+var mdStrike = regexp.MustCompile(`(^|[^\w~])~([^~\s][^~\n]*?)~`)
+
+// renderContent renders the message markdown, preferring the tree parsed by the server
+func (m messageSchema) renderContent() string {
+	if len(m.Markdown) != 0 {
+		return renderMarkdownTree(m.Markdown)
+	}
+	return renderMarkdownText(m.Content)
+}
+
+// renderMarkdownText renders markdown from the raw message text, for messages without a
+// markdown tree, fenced code blocks are boxed and any other code is left as is for the
+// code highlighting in printMessage
+func renderMarkdownText(content string) string {
+	lines := strings.Split(content, "\n")
+	output := make([]string, 0, len(lines))
+	inCode := false
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if m := mdFence.FindStringSubmatch(line); m != nil && !inCode {
+			end := i + 1
+			for end < len(lines) && !strings.HasSuffix(strings.TrimSpace(lines[end]), "```") {
+				end++
+			}
+			if end < len(lines) {
+				code := append(lines[i+1:end:end], strings.TrimSuffix(strings.TrimSpace(lines[end]), "```"))
+				output = append(output, renderCodeBlock(m[1], strings.Join(code, "\n")))
+				i = end
+				continue
+			}
+		}
+
+		if strings.Count(line, "```")%2 == 1 {
+			inCode = !inCode
+		}
+		if inCode || strings.Contains(line, "```") {
+			output = append(output, line)
+			continue
+		}
+		output = append(output, renderLineText(line))
+	}
+
+	return strings.Join(output, "\n")
+}
+
+func renderLineText(line string) string {
+	if m := mdHeading.FindStringSubmatch(line); m != nil {
+		return boldOn + underlineOn + renderInlineText(m[1]) + underlineOff + boldOff
+	}
+	if m := mdQuote.FindStringSubmatch(line); m != nil {
+		return quoteMarker + renderInlineText(m[1])
+	}
+	if m := mdUnordered.FindStringSubmatch(line); m != nil {
+		return m[1] + "• " + renderInlineText(m[2])
+	}
+	if m := mdOrdered.FindStringSubmatch(line); m != nil {
+		return m[1] + m[2] + ". " + renderInlineText(m[3])
+	}
+	return renderInlineText(line)
+}
+
+func renderInlineText(text string) string {
+	// odd segments are inline code and are left untouched
+	segments := strings.Split(text, "`")
+
+	for i := 0; i < len(segments); i += 2 {
+		segments[i] = renderLinksText(segments[i])
+	}
+
+	return strings.Join(segments, "`")
+}
+
+// renderLinksText renders the links in text and styles the text between them,
+// urls are never styled as underscores and the like are common in them
+func renderLinksText(text string) string {
+	var output string
+	last := 0
+
+	for _, loc := range mdLink.FindAllStringSubmatchIndex(text, -1) {
+		output += renderStylesText(text[last:loc[0]])
+
+		if loc[2] >= 0 {
+			output += renderLink(renderStylesText(text[loc[2]:loc[3]]), text[loc[4]:loc[5]])
+		} else {
+			output += renderLink("", text[loc[6]:loc[7]])
+		}
+		last = loc[1]
+	}
+
+	return output + renderStylesText(text[last:])
+}
+
+func renderStylesText(text string) string {
+	// without colours the markdown markers are left in place
+	if config.colourMode == "none" {
+		return text
+	}
+
+	text = mdBold.ReplaceAllString(text, "${1}"+boldOn+"${2}"+boldOff)
+	text = mdItalic.ReplaceAllString(text, "${1}"+italicOn+"${2}"+italicOff)
+	return mdStrike.ReplaceAllString(text, "${1}"+strikeOn+"${2}"+strikeOff)
+}
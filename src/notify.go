@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+type messageNotifier struct {
+	mu     sync.Mutex
+	unread int
+	last   time.Time
+}
+
+func (n *messageNotifier) shouldNotify(room roomSchema, message messageSchema) bool {
+	if me.Username != "" && message.Sender.Username == me.Username {
+		return false
+	}
+
+	if config.notifyDirect && room.Type == "d" {
+		return true
+	}
+
+	for _, name := range config.notifyRooms {
+		if name == room.Name || name == room.Fname || name == room.DisplayName {
+			return true
+		}
+	}
+
+	matched := findMentions(message.Content)
+
+	return (config.notifyMentions && (matched.self || matched.group)) || (config.notifyKeywords && matched.keyword)
+}
+
+func (n *messageNotifier) notify(room roomSchema, message messageSchema) {
+	if !n.shouldNotify(room, message) {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.unread++
+
+	if config.notifyTitle {
+		setTitle(fmt.Sprintf("rocketchat-term (%d)", n.unread))
+	}
+
+	// bursts of messages only trigger one bell or command per rate limit window
+	if time.Since(n.last) < time.Duration(config.notifyRateLimit)*time.Second {
+		return
+	}
+	n.last = time.Now()
+
+	if config.notifyBell {
+		fmt.Print("\a")
+	}
+
+	if config.notifyCommand != "" {
+		runNotifyCommand(room.DisplayName, message.Sender.Name, message.Content)
+	}
+}
+
+func (n *messageNotifier) clear() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.unread = 0
+
+	if config.notifyTitle {
+		setTitle("rocketchat-term")
+	}
+}
+
+func setTitle(title string) {
+	fmt.Printf("\033]0;%s\007", title)
+}
+
+func runNotifyCommand(room string, sender string, content string) {
+	cmd := exec.Command("sh", "-c", config.notifyCommand)
+	cmd.Env = append(os.Environ(),
+		"RC_ROOM="+room,
+		"RC_SENDER="+sender,
+		"RC_TEXT="+content,
+	)
+
+	err := cmd.Start()
+
+	if err != nil {
+		log.Println("error running notification command ", err)
+		return
+	}
+
+	go func() {
+		err := cmd.Wait()
+		if err != nil {
+			log.Println("notification command failed ", err)
+		}
+	}()
+}
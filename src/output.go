@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/c-fandango/rocketchat-term/requests"
+	"github.com/c-fandango/rocketchat-term/utils"
+)
+
+// messages updated within this many milliseconds of being sent are treated as new,
+// the server often updates a message straight after it is sent
+const newMessageAllowedDelayMS = 400
+
+type reactionSchema struct {
+	Usernames []string `json:"usernames"`
+}
+
+// jsonEvent is the schema of each line printed in jsonl output mode, see the readme
+type jsonEvent struct {
+	Event          string              `json:"event"`
+	Server         string              `json:"server"`
+	RoomID         string              `json:"room_id"`
+	RoomName       string              `json:"room_name"`
+	RoomType       string              `json:"room_type"`
+	MessageID      string              `json:"message_id"`
+	MessageType    string              `json:"message_type"`
+	ThreadID       string              `json:"thread_id"`
+	Text           string              `json:"text"`
+	SenderID       string              `json:"sender_id"`
+	SenderUsername string              `json:"sender_username"`
+	SenderName     string              `json:"sender_name"`
+	Timestamp      int                 `json:"ts"`
+	UpdatedAt      int                 `json:"updated_at"`
+	Reactions      map[string][]string `json:"reactions"`
+}
+
+// event classifies a message from the room message stream, updates are compared with the
+// previous copy of the message if it was seen, anything that can't be told apart, such as
+// a thread reply updating its parent, is a generic update
+func (m messageSchema) event(previous messageSchema, seen bool) string {
+	switch m.Type {
+	case "rm":
+		return "deleted"
+	case "uj", "ujt", "au":
+		return "room_join"
+	}
+
+	if !seen && m.UpdateTS.TS <= m.SentTS.TS+newMessageAllowedDelayMS {
+		return "message"
+	}
+
+	if m.EditedAt != nil {
+		if seen && (previous.EditedAt == nil || previous.EditedAt.TS != m.EditedAt.TS) {
+			return "edited"
+		}
+		// an edit sets the update time to the edit time
+		if !seen && m.UpdateTS.TS <= m.EditedAt.TS+newMessageAllowedDelayMS {
+			return "edited"
+		}
+	}
+
+	if seen && !sameReactions(previous.Reactions, m.Reactions) {
+		return "reaction"
+	}
+
+	return "updated"
+}
+
+func sameReactions(first map[string]reactionSchema, second map[string]reactionSchema) bool {
+	if len(first) != len(second) {
+		return false
+	}
+
+	for emoji, reaction := range first {
+		other, ok := second[emoji]
+		if !ok || len(reaction.Usernames) != len(other.Usernames) {
+			return false
+		}
+		for i := range reaction.Usernames {
+			if reaction.Usernames[i] != other.Usernames[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func printJSONEvent(event string, room roomSchema, message messageSchema) {
+	reactions := make(map[string][]string)
+	for emoji, reaction := range message.Reactions {
+		reactions[emoji] = reaction.Usernames
+	}
+
+	line, err := json.Marshal(jsonEvent{
+		Event:          event,
+		Server:         requests.Host,
+		RoomID:         message.RoomID,
+		RoomName:       room.DisplayName,
+		RoomType:       room.Type,
+		MessageID:      message.ID,
+		MessageType:    message.Type,
+		ThreadID:       message.ThreadID,
+		Text:           message.Content,
+		SenderID:       message.Sender.ID,
+		SenderUsername: message.Sender.Username,
+		SenderName:     message.Sender.Name,
+		Timestamp:      message.SentTS.TS,
+		UpdatedAt:      message.UpdateTS.TS,
+		Reactions:      reactions,
+	})
+
+	if err != nil {
+		log.Println("error encoding event ", err)
+		return
+	}
+
+	fmt.Println(string(line))
+}
+
+// messageDeletes follows the stream-notify-room deleteMessage events of each room, messages
+// removed without keeping a deleted placeholder are only reported here as the message
+// stream has nothing to send for them
+type messageDeletes struct {
+	wssResponse
+	subscribed map[string]bool
+	Fields     struct {
+		EventName string `json:"eventName"`
+		Args      []struct {
+			ID string `json:"_id"`
+		} `json:"args"`
+	} `json:"fields"`
+}
+
+func (d *messageDeletes) constructRequest(roomID string) string {
+	d.ID = utils.RandStr(5)
+
+	request := struct {
+		wssRequest
+		Params []interface{} `json:"params"`
+	}{
+		wssRequest: wssRequest{
+			ID:      d.ID,
+			Message: "sub",
+			Name:    "stream-notify-room",
+		},
+		Params: []interface{}{
+			roomID + "/deleteMessage",
+			false,
+		},
+	}
+	message, _ := json.Marshal(request)
+
+	return string(message)
+}
+
+// subscribeRooms returns the requests for rooms that aren't subscribed to yet, rooms are
+// joined while the feed is running
+func (d *messageDeletes) subscribeRooms(allRooms *rooms) []string {
+	if d.subscribed == nil {
+		d.subscribed = make(map[string]bool)
+	}
+
+	subs := make([]string, 0)
+	for _, roomID := range allRooms.roomIDs() {
+		if !d.subscribed[roomID] {
+			d.subscribed[roomID] = true
+			subs = append(subs, d.constructRequest(roomID))
+		}
+	}
+	return subs
+}
+
+func (d *messageDeletes) handleResponse(response []byte, allRooms *rooms) error {
+	d.Fields.Args = nil
+
+	err := json.Unmarshal(response, d)
+
+	if err != nil {
+		return err
+	}
+
+	roomID := strings.TrimSuffix(d.Fields.EventName, "/deleteMessage")
+
+	room, err := allRooms.findRoom(roomID)
+	if err != nil {
+		log.Println(err)
+	}
+
+	for _, arg := range d.Fields.Args {
+		// the event only has the id, the held copy fills in the rest when it was seen
+		message, ok := allRooms.findMessage(roomID, arg.ID)
+		if !ok {
+			message = messageSchema{ID: arg.ID, RoomID: roomID}
+		}
+
+		if filter.isHidden(room, message) {
+			continue
+		}
+
+		printJSONEvent("deleted", room, message)
+	}
+
+	return nil
+}
+
+// printNotice prints status information about the feed, it goes to stderr in jsonl mode
+// so that stdout only has events on it
+func printNotice(a ...interface{}) {
+	if outputFormat == "jsonl" {
+		fmt.Fprintln(os.Stderr, a...)
+		return
+	}
+	fmt.Println(a...)
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchResize keeps the terminal width up to date as the window is resized
+func watchResize() {
+	updateTerminalWidth()
+
+	resize := make(chan os.Signal, 1)
+	signal.Notify(resize, syscall.SIGWINCH)
+
+	go func() {
+		for range resize {
+			updateTerminalWidth()
+		}
+	}()
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+// watchResize reads the terminal width once as windows has no resize signal
+func watchResize() {
+	updateTerminalWidth()
+}
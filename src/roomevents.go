@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/c-fandango/rocketchat-term/utils"
+)
+
+// roomChanges follows the stream-notify-user events for rooms and subscriptions, these
+// report rooms being renamed or archived and us joining or leaving rooms
+type roomChanges struct {
+	wssResponse
+	Fields struct {
+		EventName string            `json:"eventName"`
+		Args      []json.RawMessage `json:"args"`
+	} `json:"fields"`
+}
+
+func (c *roomChanges) constructRequest(userID string, event string) string {
+	c.ID = utils.RandStr(5)
+
+	request := struct {
+		wssRequest
+		Params []interface{} `json:"params"`
+	}{
+		wssRequest: wssRequest{
+			ID:      c.ID,
+			Message: "sub",
+			Name:    "stream-notify-user",
+		},
+		Params: []interface{}{
+			userID + "/" + event,
+			false,
+		},
+	}
+	message, _ := json.Marshal(request)
+
+	return string(message)
+}
+
+func (c *roomChanges) handleResponse(response []byte, allRooms *rooms) error {
+	err := json.Unmarshal(response, c)
+
+	if err != nil {
+		return err
+	}
+
+	// args are the action, one of inserted, updated or removed, and the changed record
+	if len(c.Fields.Args) < 2 {
+		return nil
+	}
+
+	var action string
+
+	err = json.Unmarshal(c.Fields.Args[0], &action)
+
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case strings.HasSuffix(c.Fields.EventName, "/rooms-changed"):
+		var room roomSchema
+
+		err = json.Unmarshal(c.Fields.Args[1], &room)
+
+		if err != nil {
+			return err
+		}
+
+		if action != "removed" {
+			allRooms.updateRoom(room)
+		}
+
+	case strings.HasSuffix(c.Fields.EventName, "/subscriptions-changed"):
+		sub := struct {
+			RoomID string `json:"rid"`
+		}{}
+
+		err = json.Unmarshal(c.Fields.Args[1], &sub)
+
+		if err != nil {
+			return err
+		}
+
+		switch action {
+		case "inserted":
+			allRooms.joinRoom(sub.RoomID)
+		case "removed":
+			allRooms.leaveRoom(sub.RoomID)
+		}
+	}
+
+	return nil
+}
+
+func roomNotice(text string) {
+	feed.groups.reset()
+	printNotice(strings.Repeat(" ", config.indentWidth) + text)
+}
+
+// updateRoom applies changed room metadata to the cache, keeping the messages and unread
+// counts we hold, and reports changes to the name shown in the feed
+func (r *rooms) updateRoom(changed roomSchema) {
+	changed.makeName()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, room := range r.Rooms {
+		if room.ID != changed.ID {
+			continue
+		}
+
+		changed.Messages = room.Messages
+		changed.Unread = room.Unread
+		changed.Mentions = room.Mentions
+
+		// direct message updates don't always carry the usernames
+		if len(changed.Usernames) == 0 {
+			changed.Usernames = room.Usernames
+			changed.makeName()
+		}
+
+		r.Rooms[i] = changed
+
+		if changed.DisplayName != room.DisplayName {
+			roomNotice(fmt.Sprintf("%s%s is now %s%s", room.prefix(), room.DisplayName, changed.prefix(), changed.DisplayName))
+		}
+		if changed.Archived && !room.Archived {
+			roomNotice(fmt.Sprintf("%s%s was archived", changed.prefix(), changed.DisplayName))
+		}
+		return
+	}
+
+	r.Rooms = append(r.Rooms, changed)
+}
+
+// joinRoom makes sure a room we've been added to is cached and reports it
+func (r *rooms) joinRoom(roomID string) {
+	room, err := r.findRoom(roomID)
+
+	if err != nil {
+		room, err = r.fetchNewRoom(roomID)
+	}
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	roomNotice(fmt.Sprintf("joined %s%s", room.prefix(), room.DisplayName))
+}
+
+// leaveRoom drops a room we've left or been removed from and reports it
+func (r *rooms) leaveRoom(roomID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, room := range r.Rooms {
+		if room.ID == roomID {
+			r.Rooms = append(r.Rooms[:i], r.Rooms[i+1:]...)
+			roomNotice(fmt.Sprintf("no longer in %s%s", room.prefix(), room.DisplayName))
+			return
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/c-fandango/rocketchat-term/requests"
+	"github.com/c-fandango/rocketchat-term/utils"
+)
+
+func runSearchCommand(args []string) {
+	flags := flag.NewFlagSet("search", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Println("usage: rocketchat-term search [flags] <query>")
+		flags.PrintDefaults()
+	}
+
+	server := flags.Bool("server", false, "search messages on the server rather than the local archive")
+	limit := flags.Int("limit", 100, "maximum number of results per room when searching the server")
+	room := flags.String("room", "", "only search the room with this name")
+	user := flags.String("user", "", "only search messages from this username")
+	since := flags.String("since", "", "only search messages after this time, e.g 2h, 3d or 2006-01-02")
+	until := flags.String("until", "", "only search messages before this time, e.g 2h, 3d or 2006-01-02")
+
+	flags.Parse(args)
+
+	query := strings.Join(flags.Args(), " ")
+
+	q := archiveQuery{
+		text: query,
+		room: *room,
+		user: *user,
+	}
+
+	var err error
+
+	if *since != "" {
+		if q.since, err = parseTimeArg(*since); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	if *until != "" {
+		if q.until, err = parseTimeArg(*until); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	if *server {
+		err := restLogin(cachePath)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		var allRooms rooms
+
+		err = allRooms.fetchRooms()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		updateTerminalWidth()
+
+		// the server matches the text and room, the other flags filter its results
+		err = serverSearch(&allRooms, *room, query, *limit, archiveQuery{user: q.user, since: q.since, until: q.until})
+		if err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
+
+	matched, err := archive.search(q)
+
+	if err != nil {
+		fmt.Println("failed to search archive: ", err)
+		return
+	}
+
+	if len(matched) == 0 {
+		fmt.Println("no messages found")
+		return
+	}
+
+	updateTerminalWidth()
+
+	var listing displayState
+	for _, result := range matched {
+		listing.printMessage(result.room, result.message)
+	}
+}
+
+// serverSearch searches the named room, or every room if no name is given, with the
+// chat.search endpoint and prints the results matching q oldest first
+func serverSearch(allRooms *rooms, roomName string, query string, limit int, q archiveQuery) error {
+	const pageSize = 50
+
+	if query == "" {
+		return fmt.Errorf("nothing to search for")
+	}
+
+	var targets []roomSchema
+
+	if roomName != "" {
+		room, err := allRooms.findRoomByName(roomName)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, room)
+	} else {
+		allRooms.mu.Lock()
+		targets = append(targets, allRooms.Rooms...)
+		allRooms.mu.Unlock()
+	}
+
+	matched := make([]roomMessage, 0)
+
+	for _, room := range targets {
+		for offset := 0; offset < limit; offset += pageSize {
+			count := utils.MinInt(pageSize, limit-offset)
+
+			params := []map[string]string{
+				map[string]string{
+					"roomId":     room.ID,
+					"searchText": query,
+					"count":      strconv.Itoa(count),
+					"offset":     strconv.Itoa(offset),
+				},
+			}
+
+			response, err := requests.GetRequest(`/api/v1/chat.search`, params)
+
+			log.Println(string(response))
+
+			if err != nil {
+				return err
+			}
+
+			searchResult := struct {
+				Messages []messageSchema `json:"messages"`
+			}{}
+
+			err = json.Unmarshal(response, &searchResult)
+
+			if err != nil {
+				return err
+			}
+
+			for _, message := range searchResult.Messages {
+				if q.matches(room, message) {
+					matched = append(matched, roomMessage{room, message})
+				}
+			}
+
+			if len(searchResult.Messages) < count {
+				break
+			}
+		}
+	}
+
+	if len(matched) == 0 {
+		fmt.Println("no messages found")
+		return nil
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].message.SentTS.TS < matched[j].message.SentTS.TS
+	})
+
+	var listing displayState
+	for _, result := range matched {
+		listing.printMessage(result.room, result.message)
+	}
+	// the next message in the feed gets its own header
+	feed.groups.reset()
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/c-fandango/rocketchat-term/utils"
+)
+
+// systemTypes are the message types described by systemText, other types such as e2e
+// messages are shown like any other message
+var systemTypes = map[string]bool{
+	"uj":                        true,
+	"ujt":                       true,
+	"ul":                        true,
+	"ult":                       true,
+	"au":                        true,
+	"ru":                        true,
+	"r":                         true,
+	"room_changed_topic":        true,
+	"room_changed_description":  true,
+	"room_changed_announcement": true,
+	"message_pinned":            true,
+	"user-muted":                true,
+	"user-unmuted":              true,
+	"discussion-created":        true,
+}
+
+// isSystem reports whether a message is an event in the room rather than something a user wrote
+func (m messageSchema) isSystem() bool {
+	return systemTypes[m.Type]
+}
+
+// systemText describes a system message in a line, for system messages the text of the message
+// holds the subject of the event such as the user added or the new topic
+func (m messageSchema) systemText() string {
+	actor := m.Sender.Username
+	subject := m.Content
+
+	switch m.Type {
+	case "uj":
+		return actor + " joined"
+	case "ujt":
+		return actor + " joined the team"
+	case "ul":
+		return actor + " left"
+	case "ult":
+		return actor + " left the team"
+	case "au":
+		return fmt.Sprintf("%s added %s", actor, subject)
+	case "ru":
+		return fmt.Sprintf("%s removed %s", actor, subject)
+	case "r":
+		return fmt.Sprintf("%s renamed the room to %s", actor, subject)
+	case "room_changed_topic":
+		if subject == "" {
+			return actor + " cleared the topic"
+		}
+		return fmt.Sprintf("%s changed topic to %s", actor, subject)
+	case "room_changed_description":
+		return fmt.Sprintf("%s changed the description to %s", actor, subject)
+	case "room_changed_announcement":
+		return fmt.Sprintf("%s changed the announcement to %s", actor, subject)
+	case "message_pinned":
+		// the pinned message is quoted in an attachment
+		for _, attachment := range m.Attachments {
+			if attachment.Text != "" {
+				return fmt.Sprintf("%s pinned a message: %s", actor, attachment.Text)
+			}
+		}
+		return actor + " pinned a message"
+	case "user-muted":
+		return fmt.Sprintf("%s muted %s", actor, subject)
+	case "user-unmuted":
+		return fmt.Sprintf("%s unmuted %s", actor, subject)
+	case "discussion-created":
+		return fmt.Sprintf("%s started the discussion %s", actor, subject)
+	}
+
+	return subject
+}
+
+// printSystemMessage prints a system message as a dim line under the time and room columns
+func (d *displayState) printSystemMessage(matchedRoom roomSchema, message messageSchema) {
+	resetColour := "\033[0m"
+
+	room := utils.Truncate(matchedRoom.prefix()+matchedRoom.DisplayName, config.roomNameMaxWidth)
+	roomFmt := d.colours.roomColour(matchedRoom) + " " + room + " " + resetColour + strings.Repeat(" ", utils.MaxInt(config.roomWidth-utils.StringWidth(room), 0))
+
+	ts := time.UnixMilli(int64(message.SentTS.TS))
+	timePretty := utils.PadRight(formatTime(ts), " ", config.timeWidth)
+
+	text := strings.ReplaceAll(message.systemText(), "\n", " ")
+
+	// system lines are kept to one line, cut to fit the terminal
+	indent := config.indentWidth + config.timeWidth + config.roomWidth + 2
+	if width := int(terminalWidth.Load()) - indent; width > 0 {
+		text = utils.Truncate(text, width)
+	}
+
+	newLine := strings.Repeat(" ", config.indentWidth) + timePretty + roomFmt + dimOn + text + dimOff
+
+	if separator, dayChanged := d.days.check(ts); dayChanged {
+		newLine = separator + "\n" + newLine
+	}
+
+	d.groups.reset()
+	printLine(newLine)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/c-fandango/rocketchat-term/utils"
+)
+
+// templateData is the data available to display templates
+type templateData struct {
+	Time         string
+	Room         string
+	RoomType     string
+	User         string
+	Username     string
+	Content      string
+	ThreadParent string
+	Server       string
+
+	userColour string
+	roomColour string
+}
+
+// UserColour colours text in the sender's colours
+func (d templateData) UserColour(text string) string {
+	return d.userColour + text + "\033[0m"
+}
+
+// RoomColour colours text in the room's colours
+func (d templateData) RoomColour(text string) string {
+	return d.roomColour + text + "\033[0m"
+}
+
+// templateFuncs are the helper functions available to display templates
+var templateFuncs = template.FuncMap{
+	"colour": func(code string, text string) string {
+		if strings.HasPrefix(code, "#") {
+			return hexToAnsi("\033[38;2")(code) + text + "\033[0m"
+		}
+		return numToAnsi("\033[38;5")(code) + text + "\033[0m"
+	},
+	"highlight": func(code string, text string) string {
+		if strings.HasPrefix(code, "#") {
+			return hexToAnsi("\033[48;2")(code) + text + "\033[0m"
+		}
+		return numToAnsi("\033[48;5")(code) + text + "\033[0m"
+	},
+	"bold": func(text string) string {
+		return boldOn + text + boldOff
+	},
+	"dim": func(text string) string {
+		return dimOn + text + dimOff
+	},
+	"italic": func(text string) string {
+		return italicOn + text + italicOff
+	},
+	"pad": func(n int, text string) string {
+		return text + strings.Repeat(" ", utils.MaxInt(n-visibleWidth(text), 0))
+	},
+	"truncate": func(n int, text string) string {
+		return utils.Truncate(text, n)
+	},
+}
+
+func parseTemplate(layout string) *template.Template {
+	tmpl, err := template.New("display").Funcs(templateFuncs).Parse(layout)
+	if err != nil {
+		panic(fmt.Sprintf("invalid display template: %s", err))
+	}
+	return tmpl
+}
+
+func renderTemplate(data templateData) string {
+	var b strings.Builder
+
+	err := config.template.Execute(&b, data)
+	if err != nil {
+		return fmt.Sprintf("error rendering display template: %s", err)
+	}
+
+	return b.String()
+}
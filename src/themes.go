@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/knadh/koanf/providers/file"
+	"github.com/knadh/koanf/v2"
+
+	"github.com/c-fandango/rocketchat-term/utils"
+)
+
+// builtinThemes are full rgb colour schemes selectable with display.theme,
+// they use the same keys as the config file
+var builtinThemes = map[string]map[string]interface{}{
+	"dark": {
+		"colours.room_highlight": []string{"#5fd7af", "#5f87ff", "#d787d7", "#ffaf5f", "#87d75f", "#d7d75f"},
+		"colours.room_text":      []string{"#000000"},
+		"colours.user_text":      []string{"#87d7ff", "#ffaf87", "#afd787", "#d7afff", "#ffd787", "#87ffd7"},
+		"colours.notify":         "#d70000",
+		"colours.code":           "#d7d787",
+		"colours.ticket":         "#5fafff",
+		"colours.mention":        "#ff0000",
+		"colours.group_mention":  "#d75f00",
+		"colours.keyword":        "#ffff5f",
+		"colours.emoji":          "#ffaf5f",
+		"display.code_theme":     "monokai",
+	},
+	"light": {
+		"colours.room_highlight": []string{"#87d7ff", "#d7afff", "#afd787", "#ffd787", "#ffafaf", "#87d7d7"},
+		"colours.room_text":      []string{"#000000"},
+		"colours.user_text":      []string{"#005f87", "#875f00", "#5f8700", "#870087", "#af0000", "#005f5f"},
+		"colours.notify":         "#ff8787",
+		"colours.code":           "#875f00",
+		"colours.ticket":         "#0000af",
+		"colours.mention":        "#ff5f5f",
+		"colours.group_mention":  "#ffaf5f",
+		"colours.keyword":        "#af0000",
+		"colours.emoji":          "#af5f00",
+		"display.code_theme":     "github",
+	},
+	"solarized": {
+		"colours.room_highlight": []string{"#b58900", "#cb4b16", "#d33682", "#6c71c4", "#268bd2", "#2aa198", "#859900"},
+		"colours.room_text":      []string{"#002b36"},
+		"colours.user_text":      []string{"#b58900", "#cb4b16", "#d33682", "#6c71c4", "#268bd2", "#2aa198", "#859900"},
+		"colours.notify":         "#dc322f",
+		"colours.code":           "#2aa198",
+		"colours.ticket":         "#268bd2",
+		"colours.mention":        "#dc322f",
+		"colours.group_mention":  "#cb4b16",
+		"colours.keyword":        "#b58900",
+		"colours.emoji":          "#cb4b16",
+		"display.code_theme":     "solarized-dark",
+	},
+	"high-contrast": {
+		"colours.room_highlight": []string{"#ffffff", "#ffff00", "#00ffff", "#ff00ff", "#00ff00"},
+		"colours.room_text":      []string{"#000000"},
+		"colours.user_highlight": []string{"#000000"},
+		"colours.user_text":      []string{"#ffffff", "#ffff00", "#00ffff", "#ff00ff", "#00ff00"},
+		"colours.notify":         "#ff0000",
+		"colours.code":           "#00ff00",
+		"colours.ticket":         "#00ffff",
+		"colours.mention":        "#ff0000",
+		"colours.group_mention":  "#ff00ff",
+		"colours.keyword":        "#ffff00",
+		"colours.emoji":          "#ffff00",
+		"display.code_theme":     "hr_high_contrast",
+	},
+}
+
+func themeDir(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), "themes")
+}
+
+// loadTheme loads a built in theme or a theme file from the themes directory next to
+// the config file, then loads the config file on top so that it takes precedence
+func loadTheme(name string, configPath string) *koanf.Koanf {
+	var theme = koanf.New(".")
+	var user = koanf.New(".")
+
+	if builtin, ok := builtinThemes[name]; ok {
+		err := theme.Load(confmap.Provider(builtin, "."), nil)
+		if err != nil {
+			panic("failed to load theme")
+		}
+	} else {
+		path := filepath.Join(themeDir(configPath), name+".yaml")
+		if _, err := os.Stat(path); err != nil {
+			panic(fmt.Sprintf("no theme named %s", name))
+		}
+		err := theme.Load(file.Provider(path), yaml.Parser())
+		if err != nil {
+			panic("failed to parse theme file")
+		}
+	}
+
+	if _, err := os.Stat(configPath); err == nil {
+		err = user.Load(file.Provider(configPath), yaml.Parser())
+		if err != nil {
+			panic("failed to parse yaml file")
+		}
+	}
+
+	var k = koanf.New(".")
+
+	err := k.Load(confmap.Provider(themeKeys(theme, user), "."), nil)
+	if err != nil {
+		panic("failed to load theme")
+	}
+
+	err = k.Merge(user)
+	if err != nil {
+		panic("failed to load theme")
+	}
+
+	return k
+}
+
+// themeKeys returns the theme settings that apply under the user's config, a colour set in
+// the config under either colours or colours256 replaces the theme's, the theme's rgb
+// colours are only kept if truecolour was asked for, otherwise they are matched to the 256
+// colour palette so that picking a theme doesn't change the colour mode, and they are
+// dropped for 16 colour mode
+func themeKeys(theme *koanf.Koanf, user *koanf.Koanf) map[string]interface{} {
+	mode := user.String("display.colour_mode")
+	output := make(map[string]interface{})
+
+	for key, value := range theme.All() {
+		path := strings.Split(key, ".")
+
+		if path[0] != "colours" && path[0] != "colours256" {
+			output[key] = value
+			continue
+		}
+
+		if len(path) < 2 || user.Exists("colours."+path[1]) || user.Exists("colours256."+path[1]) {
+			continue
+		}
+
+		switch {
+		case mode == "16" || mode == "none":
+			continue
+		case mode != "truecolour" && path[0] == "colours":
+			output["colours256."+strings.Join(path[1:], ".")] = mapColours(value, hexTo256)
+		default:
+			output[key] = value
+		}
+	}
+
+	return output
+}
+
+func mapColours(value interface{}, f func(string) string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return f(v)
+	case []string:
+		return utils.MapperStr(v, f)
+	case []interface{}:
+		output := make([]string, len(v))
+		for i, item := range v {
+			output[i] = f(fmt.Sprint(item))
+		}
+		return output
+	}
+	return value
+}
+
+// hexTo256 picks the nearest colour of the 256 colour palette's colour cube or grey ramp
+func hexTo256(hexCode string) string {
+	r, g, b, err := utils.HexToRGB(hexCode)
+	if err != nil {
+		panic(err)
+	}
+
+	level := func(v int) int {
+		if v < 48 {
+			return 0
+		}
+		if v < 115 {
+			return 1
+		}
+		return (v - 35) / 40
+	}
+	levels := []int{0, 95, 135, 175, 215, 255}
+
+	distance := func(cr int, cg int, cb int) int {
+		return (r-cr)*(r-cr) + (g-cg)*(g-cg) + (b-cb)*(b-cb)
+	}
+
+	ri, gi, bi := level(r), level(g), level(b)
+	cube := 16 + 36*ri + 6*gi + bi
+	cubeDistance := distance(levels[ri], levels[gi], levels[bi])
+
+	grey := utils.MinInt(utils.MaxInt(((r+g+b)/3-3)/10, 0), 23)
+	greyValue := 8 + grey*10
+
+	if distance(greyValue, greyValue, greyValue) < cubeDistance {
+		return strconv.Itoa(232 + grey)
+	}
+	return strconv.Itoa(cube)
+}
+
+func themeNames(configPath string) []string {
+	names := make([]string, 0, len(builtinThemes))
+
+	for name := range builtinThemes {
+		names = append(names, name)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(themeDir(configPath), "*.yaml"))
+	for _, path := range files {
+		names = append(names, strings.TrimSuffix(filepath.Base(path), ".yaml"))
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func runThemeCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Println("usage: rocketchat-term theme list | preview [name]")
+		return
+	}
+
+	switch args[0] {
+	case "list":
+		for _, name := range themeNames(configPath) {
+			fmt.Println(name)
+		}
+	case "preview":
+		name := ""
+		if len(args) > 1 {
+			name = args[1]
+		}
+		config.loadConf(configPath, name)
+		previewTheme()
+	default:
+		fmt.Printf("unknown theme command %s\n", args[0])
+	}
+}
+
+// previewTheme prints a few made up messages to show off the current colours
+func previewTheme() {
+	updateTerminalWidth()
+
+	me = userSchema{ID: "preview-you", Username: "you", Name: "You"}
+
+	general := roomSchema{ID: "preview-general", Type: "c", Name: "general", DisplayName: "general"}
+	ops := roomSchema{ID: "preview-ops", Type: "p", Name: "ops-alerts", DisplayName: "ops-alerts"}
+	direct := roomSchema{ID: "preview-direct", Type: "d", DisplayName: "Alice Walker"}
+
+	alice := userSchema{ID: "preview-alice", Username: "alice", Name: "Alice Walker"}
+	bob := userSchema{ID: "preview-bob", Username: "bob", Name: "Bob Chen"}
+	carol := userSchema{ID: "preview-carol", Username: "carol", Name: "Carol Diaz"}
+
+	now := time.Now()
+	at := func(minutesAgo int) timestampSchema {
+		return timestampSchema{TS: int(now.Add(-time.Duration(minutesAgo) * time.Minute).UnixMilli())}
+	}
+
+	samples := []struct {
+		room    roomSchema
+		message messageSchema
+	}{
+		{general, messageSchema{ID: "1", Sender: alice, SentTS: at(12), Content: "morning all :wave: the release notes are up at https://example.com/releases"}},
+		{general, messageSchema{ID: "2", Sender: bob, SentTS: at(10), Content: "thanks @alice, *looks good* to me, _one_ question about #123456"}},
+		{ops, messageSchema{ID: "3", Sender: carol, SentTS: at(7), Content: "@here deploy of `api` is failing:\n```go\nif err != nil {\n\treturn fmt.Errorf(\"timeout\")\n}\n```"}},
+		{ops, messageSchema{ID: "4", Sender: carol, SentTS: at(6), Content: "> rolling back now\n- step one\n- step two"}},
+		{direct, messageSchema{ID: "5", Sender: alice, SentTS: at(2), Content: "@you can you take a look? :eyes:"}},
+	}
+
+	var preview displayState
+	for _, sample := range samples {
+		preview.printMessage(sample.room, sample.message)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c-fandango/rocketchat-term/utils"
+)
+
+var timePresets = map[string]string{
+	"12h": time.Kitchen,
+	"24h": "15:04",
+	"iso": "2006-01-02T15:04:05Z07:00",
+}
+
+func formatRelative(ts time.Time) string {
+	elapsed := time.Since(ts)
+
+	switch {
+	case elapsed < time.Minute:
+		return "just now"
+	case elapsed < time.Hour:
+		return fmt.Sprintf("%dm ago", int(elapsed.Minutes()))
+	case elapsed < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(elapsed.Hours()))
+	}
+	return fmt.Sprintf("%dd ago", int(elapsed.Hours()/24))
+}
+
+// formatTime formats a message timestamp in the configured timezone and layout,
+// the layout is either a preset name or a go time layout
+func formatTime(ts time.Time) string {
+	ts = ts.In(config.location)
+
+	if config.timeFormat == "relative" {
+		return formatRelative(ts)
+	}
+
+	if layout, ok := timePresets[config.timeFormat]; ok {
+		return ts.Format(layout)
+	}
+	return ts.Format(config.timeFormat)
+}
+
+// parseTimeArg reads a point in time from the command line, given either as a duration
+// before now such as 30m, 2h or 3d, or as a date such as 2006-01-02 or 2006-01-02 15:04
+func parseTimeArg(value string) (time.Time, error) {
+	if strings.HasSuffix(value, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil {
+			return time.Now().AddDate(0, 0, -days), nil
+		}
+	}
+
+	if duration, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", time.RFC3339} {
+		if ts, err := time.ParseInLocation(layout, value, config.location); err == nil {
+			return ts, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %s expecting e.g 2h, 3d or 2006-01-02", value)
+}
+
+type daySeparator struct {
+	mu      sync.Mutex
+	lastDay string
+}
+
+// check returns a separator line if ts falls on a different day to the previous message,
+// or to today for the first message
+func (d *daySeparator) check(ts time.Time) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ts = ts.In(config.location)
+	day := ts.Format("2006-01-02")
+
+	previous := d.lastDay
+	if previous == "" {
+		previous = time.Now().In(config.location).Format("2006-01-02")
+	}
+
+	changed := previous != day
+	d.lastDay = day
+
+	if !changed {
+		return "", false
+	}
+
+	label := " " + ts.Format("Monday 2 January 2006") + " "
+	width := utils.MaxInt(config.indentWidth+config.timeWidth+config.roomWidth+config.userWidth, len(label)+4)
+	side := strings.Repeat("═", (width-len(label))/2)
+
+	return side + label + side, true
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c-fandango/rocketchat-term/requests"
+	"github.com/c-fandango/rocketchat-term/utils"
+)
+
+type subscriptionSchema struct {
+	RoomID        string `json:"rid"`
+	Unread        int    `json:"unread"`
+	UserMentions  int    `json:"userMentions"`
+	GroupMentions int    `json:"groupMentions"`
+}
+
+func (r *roomSchema) countUnread(message messageSchema) {
+	// joins, topic changes and the like aren't counted by the server
+	if message.isSystem() {
+		return
+	}
+
+	// the server marks a room as read when we post in it
+	if me.Username != "" && message.Sender.Username == me.Username {
+		r.Unread = 0
+		r.Mentions = 0
+		return
+	}
+
+	r.Unread++
+
+	if matched := findMentions(message.Content); matched.self || matched.group {
+		r.Mentions++
+	}
+}
+
+func (r *rooms) fetchSubscriptions() error {
+
+	params := make([]map[string]string, 0)
+
+	response, err := requests.GetRequest(`/api/v1/subscriptions.get`, params)
+
+	log.Println(string(response))
+
+	if err != nil {
+		return err
+	}
+
+	subResult := struct {
+		Subscriptions []subscriptionSchema `json:"update"`
+	}{}
+
+	err = json.Unmarshal(response, &subResult)
+
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, sub := range subResult.Subscriptions {
+		for i := range r.Rooms {
+			if r.Rooms[i].ID == sub.RoomID {
+				r.Rooms[i].Unread = sub.Unread
+				r.Rooms[i].Mentions = sub.UserMentions + sub.GroupMentions
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *rooms) unreadRooms() []roomSchema {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	output := make([]roomSchema, 0)
+
+	for _, room := range r.Rooms {
+		if room.Unread > 0 {
+			output = append(output, room)
+		}
+	}
+	return output
+}
+
+func (r *rooms) printUnread() {
+	unread := r.unreadRooms()
+
+	if len(unread) == 0 {
+		fmt.Println("no unread messages")
+		return
+	}
+
+	for _, room := range unread {
+		line := strings.Repeat(" ", config.indentWidth) + utils.PadRight(room.prefix()+room.DisplayName, " ", config.roomWidth) + fmt.Sprintf("%d unread", room.Unread)
+		if room.Mentions > 0 {
+			line += fmt.Sprintf(", %d mentions", room.Mentions)
+		}
+		fmt.Println(line)
+	}
+}
+
+func (r *rooms) printStatusLine() {
+	unread := r.unreadRooms()
+
+	if len(unread) == 0 {
+		return
+	}
+
+	items := make([]string, len(unread))
+
+	for i, room := range unread {
+		items[i] = fmt.Sprintf("%s %d", room.DisplayName, room.Unread)
+		if room.Mentions > 0 {
+			items[i] += fmt.Sprintf(" (%d@)", room.Mentions)
+		}
+	}
+
+	fmt.Println(strings.Repeat(" ", config.indentWidth) + "unread: " + strings.Join(items, " | "))
+}
+
+// markRead clears the unread counts of the named room, or every room if name is empty
+func (r *rooms) markRead(name string) error {
+	r.mu.Lock()
+
+	matched := false
+	cleared := make([]string, 0)
+
+	for i, room := range r.Rooms {
+		if name != "" && !strings.EqualFold(name, room.Name) && !strings.EqualFold(name, room.Fname) && !strings.EqualFold(name, room.DisplayName) {
+			continue
+		}
+
+		matched = true
+
+		if room.Unread == 0 {
+			continue
+		}
+
+		r.Rooms[i].Unread = 0
+		r.Rooms[i].Mentions = 0
+		cleared = append(cleared, room.ID)
+	}
+
+	r.mu.Unlock()
+
+	if !matched {
+		return fmt.Errorf("no room named %s", name)
+	}
+
+	if !config.syncRead {
+		return nil
+	}
+
+	// the requests are made without the lock so incoming messages aren't held up
+	failed := 0
+
+	for _, roomID := range cleared {
+		err := postRead(roomID)
+
+		if err != nil {
+			log.Println("failed to mark room as read ", err)
+			failed++
+		}
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("failed to mark %d of %d rooms as read on the server", failed, len(cleared))
+	}
+
+	return nil
+}
+
+func postRead(roomID string) error {
+	response, err := requests.PostRequest(`/api/v1/subscriptions.read`, map[string]string{"rid": roomID})
+
+	log.Println(string(response))
+
+	return err
+}
+
+// readQueue batches rooms whose messages have been printed and marks them as read
+// on the server once the feed has been quiet for a while
+type readQueue struct {
+	mu      sync.Mutex
+	pending map[string]bool
+	first   time.Time
+	timer   *time.Timer
+}
+
+func (q *readQueue) add(roomID string, allRooms *rooms) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delay := time.Duration(config.markReadDelay) * time.Second
+
+	if len(q.pending) == 0 {
+		q.pending = make(map[string]bool)
+		q.first = time.Now()
+	}
+	q.pending[roomID] = true
+
+	if q.timer == nil {
+		q.timer = time.AfterFunc(delay, func() { q.flush(allRooms) })
+		return
+	}
+
+	// keep debouncing unless a busy feed has held the batch back for too long
+	if time.Since(q.first) < 4*delay {
+		q.timer.Reset(delay)
+	}
+}
+
+func (q *readQueue) flush(allRooms *rooms) {
+	q.mu.Lock()
+	pending := q.pending
+	q.pending = nil
+	q.timer = nil
+	q.mu.Unlock()
+
+	allRooms.mu.Lock()
+
+	for i, room := range allRooms.Rooms {
+		if pending[room.ID] {
+			allRooms.Rooms[i].Unread = 0
+			allRooms.Rooms[i].Mentions = 0
+		}
+	}
+
+	allRooms.mu.Unlock()
+
+	// the requests are made without the lock so incoming messages aren't held up
+	for roomID := range pending {
+		err := postRead(roomID)
+
+		if err != nil {
+			log.Println("failed to mark room as read ", err)
+		}
+	}
+}
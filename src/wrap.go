@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/c-fandango/rocketchat-term/utils"
+	"github.com/rivo/uniseg"
+	"golang.org/x/term"
+)
+
+// content narrower than this isn't worth wrapping
+const minWrapWidth = 20
+
+var terminalWidth atomic.Int64
+
+// matches csi sequences such as colours and osc sequences such as hyperlinks
+var ansiPattern = regexp.MustCompile("\033\\[[0-9;]*[A-Za-z]|\033\\][^\007\033]*(\007|\033\\\\)")
+
+func updateTerminalWidth() {
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width = 0
+	}
+	terminalWidth.Store(int64(width))
+}
+
+func stripAnsi(input string) string {
+	return ansiPattern.ReplaceAllString(input, "")
+}
+
+// replaceOutsideAnsi applies replace to the text between escape sequences so that
+// sequences such as hyperlink targets are never altered
+func replaceOutsideAnsi(input string, replace func(string) string) string {
+	var b strings.Builder
+	last := 0
+
+	for _, loc := range ansiPattern.FindAllStringIndex(input, -1) {
+		b.WriteString(replace(input[last:loc[0]]))
+		b.WriteString(input[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	b.WriteString(replace(input[last:]))
+
+	return b.String()
+}
+
+func visibleWidth(input string) int {
+	return utils.StringWidth(stripAnsi(input))
+}
+
+func isURL(word string) bool {
+	return strings.Contains(stripAnsi(word), "://")
+}
+
+// splitVisible splits input after at most n visible columns without breaking
+// escape sequences or grapheme clusters
+func splitVisible(input string, n int) (string, string) {
+	width := 0
+	i := 0
+
+	for i < len(input) {
+		if loc := ansiPattern.FindStringIndex(input[i:]); loc != nil && loc[0] == 0 {
+			i += loc[1]
+			continue
+		}
+		cluster, _, clusterWidth, _ := uniseg.FirstGraphemeClusterInString(input[i:], -1)
+		// always take at least one cluster so wrapping makes progress
+		if width+clusterWidth > n && width > 0 {
+			break
+		}
+		i += len(cluster)
+		width += clusterWidth
+	}
+	return input[:i], input[i:]
+}
+
+// wrapContent wraps content at word boundaries so that every line fits in the terminal,
+// continuation lines are indented to the content column
+func wrapContent(content string, indent int, width int) string {
+	newLine := "\n" + strings.Repeat(" ", indent)
+	available := width - indent
+
+	if available < minWrapWidth {
+		return strings.ReplaceAll(content, "\n", newLine)
+	}
+
+	var b strings.Builder
+
+	for i, line := range strings.Split(content, "\n") {
+		if i > 0 {
+			b.WriteString(newLine)
+		}
+
+		// code is split where it reaches the edge, keeping its spacing and the box border
+		if strings.HasPrefix(line, codeBorder) {
+			rest := strings.TrimPrefix(line, codeBorder)
+			b.WriteString(codeBorder)
+			for visibleWidth(rest) > available-2 {
+				var head string
+				head, rest = splitVisible(rest, available-2)
+				b.WriteString(head + newLine + codeBorder)
+			}
+			b.WriteString(rest)
+			continue
+		}
+
+		col := 0
+
+		for j, word := range strings.Split(line, " ") {
+			w := visibleWidth(word)
+
+			if j > 0 {
+				if col > 0 && col+1+w > available {
+					b.WriteString(newLine)
+					col = 0
+				} else {
+					b.WriteString(" ")
+					col++
+				}
+			}
+
+			// urls are left whole so they stay clickable
+			for col+w > available && !isURL(word) {
+				var head string
+				head, word = splitVisible(word, available-col)
+				b.WriteString(head + newLine)
+				col = 0
+				w = visibleWidth(word)
+			}
+
+			b.WriteString(word)
+			col += w
+		}
+	}
+
+	return b.String()
+}
@@ -6,7 +6,8 @@ import (
 	"math/rand"
 	"strconv"
 	"strings"
-	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
 )
 
 func RandStr(n int) string {
@@ -18,15 +19,48 @@ func RandStr(n int) string {
 	return string(b)
 }
 
+// StringWidth returns the number of terminal columns input occupies,
+// wide characters such as CJK and most emoji take two columns
+func StringWidth(input string) int {
+	return uniseg.StringWidth(input)
+}
+
+// Truncate shortens input to at most n columns without splitting grapheme clusters,
+// marking the cut with an ellipsis
+func Truncate(input string, n int) string {
+	const ellipsis = "…"
+
+	if StringWidth(input) <= n {
+		return input
+	}
+
+	var output string
+	width := 0
+	state := -1
+
+	for len(input) > 0 {
+		var cluster string
+		var clusterWidth int
+		cluster, input, clusterWidth, state = uniseg.FirstGraphemeClusterInString(input, state)
+		if width+clusterWidth > n-1 {
+			break
+		}
+		output += cluster
+		width += clusterWidth
+	}
+
+	return output + ellipsis
+}
+
 func PadLeft(input string, padding string, n int) string {
-	for utf8.RuneCountInString(input) < n {
+	for StringWidth(input) < n {
 		input = padding + input
 	}
 	return input
 }
 
 func PadRight(input string, padding string, n int) string {
-	for utf8.RuneCountInString(input) < n {
+	for StringWidth(input) < n {
 		input += padding
 	}
 	return input
@@ -70,6 +104,15 @@ func MapperStr(input []string, f func(string) string) []string {
 	return output
 }
 
+func ContainsStr(input []string, target string) bool {
+	for _, item := range input {
+		if item == target {
+			return true
+		}
+	}
+	return false
+}
+
 func HexToRGB(hexCode string) (int, int, int, error) {
 	if len(hexCode) != 6 {
 		if len(hexCode) != 7 || hexCode[0] != '#' {